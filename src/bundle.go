@@ -0,0 +1,360 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// latexReference matches the LaTeX commands that name another file.
+var latexReference = regexp.MustCompile(`\\(?:includegraphics|includepdf|includesvg|input|include|subfile|lstinputlisting|bibliography|addbibresource)\*?\s*(?:\[[^\]]*\]\s*)*\{([^{}]+)\}`)
+
+// Bundle represents a group of related files that are sorted together. Files
+// belong to a bundle when they share a name without the extension, or a
+// jobname, and, if Extensions is set, have one of its extensions.
+type Bundle struct {
+	Name string `json:"name,omitempty"`
+	// Extensions lists the sidecar extensions of the bundle, compared
+	// ignoring case. The file with the earliest one leads the bundle; without
+	// extensions any files sharing a name form a bundle, led by the one whose
+	// rule comes first.
+	Extensions []string `json:"extensions,omitempty"`
+	// Jobname groups the files by their solver jobname rather than their
+	// name, so an input deck setting the jobname joins the job's results.
+	Jobname bool `json:"jobname,omitempty"`
+	// References adds the files a LaTeX file of the bundle names with
+	// \includegraphics, \input, \include, \bibliography and the like.
+	References bool `json:"references,omitempty"`
+	// Destination is the folder the bundle goes into, with the same
+	// placeholders as a rule taken from the leading file. Without it the
+	// bundle follows its leading file.
+	Destination string `json:"destination,omitempty"`
+
+	extensions map[string]int
+}
+
+// Validate checks the bundle and prepares its extensions for matching.
+func (b *Bundle) Validate() error {
+	for _, placeholder := range templatePlaceholder.FindAllString(b.Destination, -1) {
+		switch placeholder {
+		case "{name}", "{stem}", "{ext}":
+		default:
+			return fmt.Errorf("bundle '%s' has an unknown placeholder %s in its destination", b.Name, placeholder)
+		}
+	}
+
+	b.extensions = make(map[string]int)
+	for i, extension := range b.Extensions {
+		extension = strings.ToLower(extension)
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		if _, ok := b.extensions[extension]; !ok {
+			b.extensions[extension] = i
+		}
+	}
+	return nil
+}
+
+func (b *Bundle) String() string {
+	if b.Name == "" {
+		return "bundle"
+	}
+	return fmt.Sprintf("bundle '%s'", b.Name)
+}
+
+// Folder returns the destination of the bundle when it is led by a file
+// named name, or an empty string if the bundle follows that file.
+func (b *Bundle) Folder(name string) string {
+	if b.Destination == "" {
+		return ""
+	}
+	return (&Rule{Destination: b.Destination}).Folder(name)
+}
+
+// BundleSet represents bundles claiming files in order.
+type BundleSet []*Bundle
+
+// DefaultBundles returns the bundles used when no config declares any.
+func DefaultBundles() BundleSet {
+	return BundleSet{
+		{Name: "latex", Extensions: []string{".tex", ".pdf", ".bib", ".bbl", ".cls", ".sty"}, References: true},
+		{Name: "solver jobs", Extensions: []string{".rst", ".rth", ".rmg", ".rfl", ".d3plot", ".d3hsp", ".db", ".dbb", ".cdb", ".esav", ".full", ".emat", ".out", ".glstat", ".matsum", ".messag", ".binout", ".d3thdt", ".inp", ".ans", ".dat", ".mac", ".k", ".key", ".dyn"}, Jobname: true},
+	}
+}
+
+// Validate checks every bundle.
+func (s BundleSet) Validate() error {
+	for i, bundle := range s {
+		err := bundle.Validate()
+		if err != nil {
+			return fmt.Errorf("invalid bundle %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Apply puts every bundled file into the folder of its bundle. plans must
+// already be classified by rules and grouped.
+func (s BundleSet) Apply(plans []*SortPlan, rules RuleSet) {
+	order := make(map[*Rule]int)
+	for i, rule := range rules {
+		order[rule] = i
+	}
+	// Files without a rule lose to any with one
+	rank := func(plan *SortPlan) int {
+		if i, ok := order[plan.Rule]; ok {
+			return i
+		}
+		return len(rules)
+	}
+
+	var graph map[*SortPlan][]*SortPlan
+	referenced := make(map[*SortPlan]bool)
+	for _, bundle := range s {
+		if bundle.References && graph == nil {
+			graph = referenceGraph(plans)
+			for _, targets := range graph {
+				for _, target := range targets {
+					referenced[target] = true
+				}
+			}
+		}
+	}
+
+	bundled := make(map[*SortPlan]bool)
+	for _, bundle := range s {
+		if bundle.extensions == nil && bundle.Validate() != nil {
+			continue
+		}
+
+		var stems []string
+		members := make(map[string][]*SortPlan)
+		for _, plan := range plans {
+			if bundled[plan] {
+				continue
+			}
+			name := strings.ToLower(filepath.Base(plan.File.Rel))
+			extension := filepath.Ext(name)
+			if _, ok := bundle.extensions[extension]; len(bundle.extensions) > 0 && !ok {
+				continue
+			}
+			stem := strings.TrimSuffix(name, extension)
+			if bundle.Jobname {
+				stem = plan.File.Jobname()
+			}
+			if members[stem] == nil {
+				stems = append(stems, stem)
+			}
+			members[stem] = append(members[stem], plan)
+		}
+		if bundle.References {
+			// Files included by others join their bundle instead of leading
+			// their own
+			isReferenced := func(stem string) bool {
+				for _, plan := range members[stem] {
+					if referenced[plan] {
+						return true
+					}
+				}
+				return false
+			}
+			sort.SliceStable(stems, func(i, j int) bool {
+				return !isReferenced(stems[i]) && isReferenced(stems[j])
+			})
+		}
+
+		for _, stem := range stems {
+			var group []*SortPlan
+			for _, plan := range members[stem] {
+				// A file may have joined an earlier bundle by reference
+				if !bundled[plan] {
+					group = append(group, plan)
+				}
+			}
+			if bundle.References {
+				group = append(group, references(group, graph, bundled)...)
+			}
+			if len(group) < 2 {
+				continue
+			}
+
+			lead := group[0]
+			for _, plan := range group[1:] {
+				if bundle.before(plan, lead, rank) {
+					lead = plan
+				}
+			}
+			folder := bundle.Folder(filepath.Base(lead.File.Rel))
+			job := lead.Job
+			if anchor := anchorOf(group, lead); anchor != nil {
+				// The bundle stays with the file that cannot move, and only
+				// joins its job if that is already in the job's folder
+				folder = filepath.Dir(anchor.File.Rel)
+				if folder != lead.Folder {
+					job = nil
+				}
+			}
+			if folder == "" {
+				if lead.Rule == nil {
+					continue
+				}
+				folder = lead.Folder
+			}
+			if filepath.IsAbs(folder) || isParentRelative(folder) {
+				continue
+			}
+
+			for _, plan := range group {
+				bundled[plan] = true
+				plan.Folder = folder
+				plan.Bundle, plan.Lead, plan.Job = bundle, lead, job
+			}
+		}
+	}
+}
+
+// anchorOf returns the file of the group that is never moved, preferring the
+// lead, or nil if every file of the group can be moved.
+func anchorOf(group []*SortPlan, lead *SortPlan) *SortPlan {
+	if lead.Anchor {
+		return lead
+	}
+	for _, plan := range group {
+		if plan.Anchor {
+			return plan
+		}
+	}
+	return nil
+}
+
+// walkBundled walks the files of the project at root that scope covers, and
+// passes fn the ones only the project's .gitignore leaves out as anchors, so
+// that their bundles still find them. Ignored directories are not entered.
+func walkBundled(fsys FileSystem, root string, scope *Scope, fn func(path, rel string, info os.FileInfo, anchor bool) error) error {
+	ignore, err := LoadIgnoreMatcher(fsys, root, false)
+	if err != nil {
+		return err
+	}
+	wide := &Scope{Ignore: ignore, Symlinks: scope.Symlinks}
+	return walkProject(fsys, root, wide, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		ignored := scope.Ignore != nil && scope.Ignore.Match(rel, info.IsDir())
+		if info.IsDir() {
+			if ignored {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return fn(path, rel, info, ignored)
+	})
+}
+
+// before reports whether the file of a should lead the bundle rather than b.
+func (b *Bundle) before(a, other *SortPlan, rank func(*SortPlan) int) bool {
+	if ea, eb := b.extensionRank(a), b.extensionRank(other); ea != eb {
+		return ea < eb
+	}
+	return rank(a) < rank(other)
+}
+
+// extensionRank returns the position of the extension of the file in the
+// sidecar extensions, after all of them if it is not one.
+func (b *Bundle) extensionRank(plan *SortPlan) int {
+	if i, ok := b.extensions[strings.ToLower(filepath.Ext(plan.File.Rel))]; ok {
+		return i
+	}
+	return len(b.Extensions)
+}
+
+// referenceGraph returns the files each LaTeX file among plans names.
+func referenceGraph(plans []*SortPlan) map[*SortPlan][]*SortPlan {
+	byName := make(map[string]*SortPlan)
+	byStem := make(map[string][]*SortPlan)
+	for _, plan := range plans {
+		name := strings.ToLower(filepath.Base(plan.File.Rel))
+		byName[name] = plan
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		byStem[stem] = append(byStem[stem], plan)
+	}
+
+	graph := make(map[*SortPlan][]*SortPlan)
+	for _, plan := range plans {
+		if strings.ToLower(filepath.Ext(plan.File.Rel)) != ".tex" {
+			continue
+		}
+		for _, name := range plan.File.references() {
+			name = transformFileName(filepath.Base(filepath.FromSlash(name)))
+			// \input{intro} names intro.tex, \includegraphics{fig1} any
+			// fig1 image and \bibliography{refs} refs.bib
+			targets := byStem[name]
+			if target := byName[name+".tex"]; target != nil {
+				targets = []*SortPlan{target}
+			}
+			if target := byName[name]; target != nil {
+				targets = []*SortPlan{target}
+			}
+			for _, target := range targets {
+				if target != plan {
+					graph[plan] = append(graph[plan], target)
+				}
+			}
+		}
+	}
+	return graph
+}
+
+// references returns the files the group names in graph, and the files they
+// name in turn, that are not bundled yet.
+func references(group []*SortPlan, graph map[*SortPlan][]*SortPlan, bundled map[*SortPlan]bool) []*SortPlan {
+	seen := make(map[*SortPlan]bool)
+	for _, plan := range group {
+		seen[plan] = true
+	}
+	var found []*SortPlan
+	queue := append([]*SortPlan(nil), group...)
+	for len(queue) > 0 {
+		plan := queue[0]
+		queue = queue[1:]
+		for _, target := range graph[plan] {
+			if seen[target] || bundled[target] {
+				continue
+			}
+			seen[target] = true
+			found = append(found, target)
+			queue = append(queue, target)
+		}
+	}
+	return found
+}
+
+// references returns the file names a LaTeX file refers to.
+func (c *Candidate) references() []string {
+	var names []string
+	for _, line := range strings.Split(c.text(), "\n") {
+		// Leave out commented references
+		if i := strings.Index(line, "%"); i >= 0 && (i == 0 || line[i-1] != '\\') {
+			line = line[:i]
+		}
+		for _, match := range latexReference.FindAllStringSubmatch(line, -1) {
+			for _, name := range strings.Split(match[1], ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBundleKeepsIgnoredPartners(t *testing.T) {
+	tests := []struct {
+		name     string
+		tree     map[string]string
+		misplace []string
+	}{
+		{
+			name: "sorted job with ignored results",
+			tree: map[string]string{
+				".gitignore":          "*.rst\n*.db\n",
+				"job/model/model.inp": "/PREP7\n",
+				"job/model/model.rst": "results",
+				"job/model/model.db":  "database",
+			},
+		},
+		{
+			name: "input deck stays next to ignored results",
+			tree: map[string]string{
+				".gitignore": "*.rst\n",
+				"model.inp":  "/PREP7\n",
+				"model.rst":  "results",
+			},
+		},
+		{
+			name: "input deck joins results that are not ignored",
+			tree: map[string]string{
+				"model.inp": "/PREP7\n",
+				"model.rst": "results",
+			},
+			misplace: []string{"'model.inp' belongs in 'job/model'", "'model.rst' belongs in 'job/model'"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projectPath := t.TempDir()
+			writeTree(t, projectPath, tt.tree)
+
+			checker := testChecker(t, projectPath)
+			err := checker.Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var misplaced []string
+			for _, problem := range checker.Problems {
+				if strings.Contains(problem, "belongs in") {
+					misplaced = append(misplaced, problem)
+				}
+			}
+			if len(misplaced) != len(tt.misplace) {
+				t.Fatalf("misplaced files %q, want %q", misplaced, tt.misplace)
+			}
+			for i, want := range tt.misplace {
+				if !strings.HasPrefix(misplaced[i], want) {
+					t.Errorf("problem %q, want %q", misplaced[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Checker represents the template for checking whether a project follows the
+// project structure without changing anything.
+type Checker struct {
+	FolderPath string
+	FileSystem FileSystem
+	Scope      *Scope
+	Layout     *Layout
+	Rules      RuleSet
+	Bundles    BundleSet
+	Problems   []string
+}
+
+// Execute collects every way the project differs from the structure enforce
+// would give it.
+func (c *Checker) Execute() error {
+	c.Problems = nil
+
+	for _, dir := range c.Layout.Directories() {
+		c.expect(filepath.Join(c.FolderPath, dir), "missing directory '%s'", dir)
+	}
+	for _, file := range c.Layout.Files() {
+		c.expect(filepath.Join(c.FolderPath, file), "missing file '%s'", file)
+	}
+	c.expect(filepath.Join(c.FolderPath, ".git"), "missing Git repository")
+	c.expect(filepath.Join(c.FolderPath, ".gitignore"), "missing .gitignore")
+
+	var plans []*SortPlan
+	err := walkBundled(c.FileSystem, c.FolderPath, c.Scope, func(path, rel string, info os.FileInfo, anchor bool) error {
+		if rel == ".gitignore" || rel == enforceIgnoreFileName || c.Layout.IsRequiredFile(rel) || isJobIndex(c.FileSystem, path) {
+			return nil
+		}
+		if anchor {
+			// Ignored files are left alone but keep their bundles with them
+			file := NewCandidate(c.FileSystem, path, rel, info)
+			rule, folder := c.Rules.Classify(file)
+			plans = append(plans, &SortPlan{Path: rel, File: file, Rule: rule, Folder: folder, Anchor: true})
+			return nil
+		}
+
+		name := info.Name()
+		if normalized := transformFileName(name); normalized != name {
+			c.Problems = append(c.Problems, fmt.Sprintf("'%s' should be named '%s'", rel, normalized))
+			name = normalized
+		}
+		file := NewCandidate(c.FileSystem, path, filepath.Join(filepath.Dir(rel), name), info)
+		if content := file.Content(); ContentMismatch(name, content) {
+			c.Problems = append(c.Problems, fmt.Sprintf("'%s' contains %s but its extension is '%s'", rel, content, filepath.Ext(name)))
+		}
+		rule, folder := c.Rules.Classify(file)
+		plans = append(plans, &SortPlan{Path: rel, File: file, Rule: rule, Folder: folder})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check project: %w", err)
+	}
+
+	c.Layout.GroupPlans(plans)
+	c.Bundles.Apply(plans, c.Rules)
+	for _, plan := range plans {
+		if plan.Sorted() && filepath.Dir(plan.Path) != plan.Folder {
+			c.Problems = append(c.Problems, fmt.Sprintf("'%s' belongs in '%s' (%s)", plan.Path, plan.Folder, plan.Reason()))
+		}
+	}
+	return nil
+}
+
+func (c *Checker) expect(path, format string, args ...interface{}) {
+	if _, err := c.FileSystem.Lstat(path); err != nil {
+		c.Problems = append(c.Problems, fmt.Sprintf(format, args...))
+	}
+}
+
+// Print writes the problems found to w.
+func (c *Checker) Print(w io.Writer) {
+	if len(c.Problems) == 0 {
+		fmt.Fprintf(w, "'%s' follows the project structure.\n", c.FolderPath)
+		return
+	}
+	fmt.Fprintf(w, "Problems in '%s' (%d):\n", c.FolderPath, len(c.Problems))
+	for _, problem := range c.Problems {
+		fmt.Fprintf(w, "  %s\n", problem)
+	}
+}
+
+// CheckObject is the JSON form of the result of a check.
+type CheckObject struct {
+	Type     string   `json:"type"`
+	Project  string   `json:"project"`
+	Status   string   `json:"status"`
+	Problems []string `json:"problems"`
+}
+
+// Object returns the JSON form of the problems found.
+func (c *Checker) Object() CheckObject {
+	obj := CheckObject{Type: "check", Project: c.FolderPath, Status: "ok", Problems: c.Problems}
+	if len(c.Problems) > 0 {
+		obj.Status = "failed"
+	} else {
+		obj.Problems = []string{}
+	}
+	return obj
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testChecker returns a checker of the project at projectPath with the
+// default settings.
+func testChecker(t *testing.T, projectPath string) *Checker {
+	t.Helper()
+	fsys := &OSFileSystem{}
+	ignore, err := LoadIgnoreMatcher(fsys, projectPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := &Options{}
+	return &Checker{
+		FolderPath: projectPath,
+		FileSystem: fsys,
+		Scope:      &Scope{Ignore: ignore, Symlinks: SymlinkKeep},
+		Layout:     options.layout(),
+		Rules:      options.rules(),
+		Bundles:    options.bundles(),
+	}
+}
+
+func TestSortCheckRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		tree map[string]string
+	}{
+		{"documents and media", map[string]string{
+			"Report.pdf":              "%PDF-1.4",
+			"notes/Meeting Notes.txt": "notes",
+			"img/Photo.JPG":           "photo",
+			"script.py":               "print()",
+			"tool.exe":                "MZ",
+			"measurements.csv":        "1,2",
+		}},
+		{"solver job with results", map[string]string{
+			"model.inp":     "/PREP7\n",
+			"out/model.rst": "results",
+			"out/model.db":  "database",
+			"out/model.out": "output",
+		}},
+		{"latex paper", map[string]string{
+			"paper/Paper.tex":  "\\input{intro}\n\\includegraphics{fig1}\n\\bibliography{refs}\n",
+			"paper/intro.tex":  "Introduction",
+			"paper/Paper.pdf":  "%PDF-1.4",
+			"figures/fig1.png": "png",
+			"refs.bib":         "@article{}",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			projectPath := filepath.Join(parent, "My Proj")
+			writeTree(t, projectPath, tt.tree)
+
+			err := testRun(projectPath).Execute()
+			if err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+			// Git may not be installed; the check only looks for the directory
+			projectPath = filepath.Join(parent, "my_proj")
+			if err := os.Mkdir(filepath.Join(projectPath, ".git"), 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			checker := testChecker(t, projectPath)
+			err = checker.Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, problem := range checker.Problems {
+				t.Errorf("check after the run: %s", problem)
+			}
+		})
+	}
+}
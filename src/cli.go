@@ -0,0 +1,725 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// Command represents an enforce subcommand.
+type Command struct {
+	Name    string
+	Args    string
+	Summary string
+	Run     func(c *CLI, args []string) error
+}
+
+// commands lists every subcommand in the order they are shown in the usage.
+var commands = []*Command{
+	{Name: "init", Args: "[path]", Summary: "flatten, rename, scaffold and sort a project and initialize Git (the default)", Run: stageCommand(AllStages()...)},
+	{Name: "flatten", Args: "[path]", Summary: "move every file into the project directory and remove empty directories", Run: stageCommand(StageDedupe, StageFlatten, StagePrune)},
+	{Name: "rename", Args: "[path]", Summary: "normalize file names", Run: stageCommand(StageRename)},
+	{Name: "scaffold", Args: "[path]", Summary: "create the project directories", Run: stageCommand(StageScaffold)},
+	{Name: "sort", Args: "[path]", Summary: "create the project directories and sort files into them", Run: stageCommand(StageDedupe, StageScaffold, StageSort)},
+	{Name: "workspace", Args: "<parent>", Summary: "run the stages on every project directory in parent", Run: (*CLI).workspace},
+	{Name: "check", Args: "[path]", Summary: "report how a project differs from the structure without changing it", Run: (*CLI).check},
+	{Name: "explain", Args: "<file>...", Summary: "show how files would be renamed and sorted, and which rules they nearly matched", Run: (*CLI).explain},
+	{Name: "undo", Args: "[path]", Summary: "undo the last run using the project's journal", Run: (*CLI).undo},
+	{Name: "restore", Args: "<snapshot> [path]", Summary: "restore a project from a snapshot", Run: (*CLI).restore},
+	{Name: "presets", Args: "", Summary: "list the layout presets", Run: (*CLI).presets},
+	{Name: "config", Args: "show [path]", Summary: "show the config files, or with --effective the merged settings and their sources", Run: (*CLI).config},
+}
+
+// findCommand returns the subcommand called name, or nil.
+func findCommand(name string) *Command {
+	for _, c := range commands {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// CLI holds the command-line flags shared by every command.
+type CLI struct {
+	flags       *flag.FlagSet
+	dryRun      bool
+	allowSystem bool
+	yes         bool
+	only        string
+	skip        string
+	output      string
+	quiet       bool
+	verbose     bool
+	out         io.Writer
+	events      *EventLog
+	log         *slog.Logger
+	args        []string
+}
+
+// NewCLI creates a command line that writes its output to out.
+func NewCLI(out io.Writer) *CLI {
+	c := &CLI{flags: flag.NewFlagSet("enforce", flag.ContinueOnError), out: out}
+	f := c.flags
+	f.SetOutput(out)
+	f.BoolVar(&c.dryRun, "dry-run", false, "print the planned operations without changing anything")
+	// Layered settings are read back through LoadSettings, which also
+	// consults config files and the environment
+	f.String("dedupe", string(DedupeOff), "what to do with duplicate files: off, report, quarantine or hardlink")
+	f.Bool("gitignore", true, "leave paths ignored by the project's .gitignore alone")
+	f.String("snapshot", "", "write a snapshot of the project to this directory before changing it")
+	f.String("snapshot-format", string(SnapshotTarGz), "snapshot archive format: tar.gz or zip")
+	f.String("symlinks", string(SymlinkKeep), "what to do with symlinks: keep, move, resolve or skip")
+	f.String("conflict", string(ConflictSuffix), "what to do when a destination exists: abort, skip, suffix or prefix")
+	f.Int("max-files", 10000, "refuse projects with more files than this, 0 for no limit")
+	f.String("max-size", "10GiB", "refuse projects larger than this, 0 for no limit")
+	f.String("preset", "", "layout preset, "+DefaultPreset+" unless configured (see enforce presets)")
+	f.BoolVar(&c.allowSystem, "allow-system", false, "allow enforcing file system roots, home directories and system directories")
+	f.BoolVar(&c.yes, "yes", false, "apply changes without asking for confirmation")
+	f.StringVar(&c.only, "only", "", "run only these comma separated stages")
+	f.StringVar(&c.skip, "skip", "", "skip these comma separated stages")
+	f.BoolVar(&c.quiet, "quiet", false, "only log warnings and errors")
+	f.BoolVar(&c.verbose, "verbose", false, "log every step, including debug messages")
+	f.StringVar(&c.output, "output", string(OutputText), "output format: text, or json for one JSON object per operation and a summary")
+	f.Usage = c.usage
+	return c
+}
+
+func (c *CLI) usage() {
+	fmt.Fprintln(c.out, "Usage: enforce [command] [flags] [path]")
+	fmt.Fprintln(c.out, "\nCommands:")
+	for _, command := range commands {
+		fmt.Fprintf(c.out, "  %-8s %-18s %s\n", command.Name, command.Args, command.Summary)
+	}
+	fmt.Fprintln(c.out, "\nStages, in the order they run:")
+	for _, stage := range Stages {
+		requires := ""
+		if len(stage.Requires) > 0 {
+			requires = " (requires " + strings.Join(stage.Requires, ", ") + ")"
+		}
+		fmt.Fprintf(c.out, "  %-9s %s%s\n", stage.Name, stage.Summary, requires)
+	}
+	fmt.Fprintln(c.out, "\nWithout a path the project directory is picked in a dialog, or on the\nterminal when there is no display.")
+	fmt.Fprintln(c.out, "\nFlags:")
+	c.flags.PrintDefaults()
+}
+
+// Execute parses args and runs the command they name. Flags may come before
+// or after the command.
+func (c *CLI) Execute(args []string) error {
+	c.args = args
+	err := c.flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	args = c.flags.Args()
+
+	command := findCommand("init")
+	if len(args) > 0 {
+		if named := findCommand(args[0]); named != nil {
+			command = named
+			err = c.flags.Parse(args[1:])
+			if err != nil {
+				return err
+			}
+			args = c.flags.Args()
+		} else if args[0] == "help" {
+			c.usage()
+			return nil
+		}
+	}
+
+	format, err := ParseOutputFormat(c.output)
+	if err != nil {
+		return err
+	}
+	if format == OutputJSON {
+		c.events = NewEventLog(c.out)
+	}
+
+	// Log to the text output, or to stderr to keep JSON output parseable
+	level := slog.LevelInfo
+	switch {
+	case c.quiet && c.verbose:
+		return errors.New("-quiet and -verbose cannot be combined")
+	case c.quiet:
+		level = slog.LevelWarn
+	case c.verbose:
+		level = slog.LevelDebug
+	}
+	logOut := c.out
+	if c.events != nil {
+		logOut = os.Stderr
+	}
+	c.log = slog.New(newConsoleHandler(logOut, level))
+	return command.Run(c, args)
+}
+
+// projectLog opens the log file of the project and returns a logger writing
+// to both the console and the file, one writing to the file only and the
+// file, to be closed when done.
+func (c *CLI) projectLog(projectPath string) (*slog.Logger, *slog.Logger, *LogFile, error) {
+	file, err := OpenLogFile(projectPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	fileHandler := slog.NewTextHandler(file, &slog.HandlerOptions{Level: slog.LevelDebug})
+	fileLog := slog.New(fileHandler).With("args", c.args, "pid", os.Getpid())
+	runLog := slog.New(teeHandler{c.log.Handler(), fileHandler})
+	return runLog, fileLog, file, nil
+}
+
+// text returns where human readable output goes, nowhere when the output
+// is JSON.
+func (c *CLI) text() io.Writer {
+	if c.events != nil {
+		return io.Discard
+	}
+	return c.out
+}
+
+// projectPath returns the project path given in args, or asks for one in a
+// dialog when none is given.
+func (c *CLI) projectPath(args []string) (string, error) {
+	projectPath := ""
+	if len(args) > 0 {
+		projectPath = args[0]
+	} else {
+		dialogFactory := &DirectoryDialogFactory{}
+		dialog := dialogFactory.CreateDialog()
+		path, err := dialog.Browse()
+		if err != nil {
+			return "", err
+		}
+		projectPath = path
+	}
+
+	// Validate the project path exists
+	info, err := os.Stat(projectPath)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("project path '%s' does not exist", projectPath)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("project path '%s' is not a directory", projectPath)
+	}
+	// The journal records absolute paths so undo works from anywhere
+	projectPath, err = filepath.Abs(projectPath)
+	if err != nil {
+		return "", err
+	}
+
+	// Failing to remember the project is not worth stopping for
+	_ = AddRecentProject(projectPath)
+	return projectPath, nil
+}
+
+// settings returns the effective configuration of the project at
+// projectPath, or of no project in particular if it is empty.
+func (c *CLI) settings(projectPath string) (*Settings, error) {
+	return LoadSettings(projectPath, c.flags)
+}
+
+// stageCommand returns a command that runs the given stages of a run.
+func stageCommand(stages ...string) func(c *CLI, args []string) error {
+	return func(c *CLI, args []string) error {
+		selected, err := SelectStages(stages, splitList(c.only), splitList(c.skip))
+		if err != nil {
+			return err
+		}
+		projectPath, err := c.projectPath(args)
+		if err != nil {
+			return err
+		}
+		return c.enforce(projectPath, selected)
+	}
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// guard creates the safety checks configured in settings and on the command
+// line.
+func (c *CLI) guard(settings *Settings) (*Guard, error) {
+	maxBytes, err := parseSize(settings.Value("max_size"))
+	if err != nil {
+		return nil, settings.invalid("max_size", err)
+	}
+	// Keep questions out of JSON output
+	out := c.out
+	if c.events != nil {
+		out = os.Stderr
+	}
+	return &Guard{
+		AllowSystem:      c.allowSystem,
+		MaxFiles:         *settings.Config.MaxFiles,
+		MaxBytes:         maxBytes,
+		SkipConfirmation: c.yes || c.dryRun,
+		In:               os.Stdin,
+		Out:              out,
+	}, nil
+}
+
+// checkProject refuses dangerous directories and projects over the size limits.
+func (c *CLI) checkProject(guard *Guard, projectPath string, options *Options) error {
+	err := guard.CheckPath(projectPath)
+	if err != nil {
+		return err
+	}
+	ignore, err := LoadIgnoreMatcher(&OSFileSystem{}, projectPath, options.UseGitignore)
+	if err != nil {
+		return err
+	}
+	return guard.CheckLimits(&OSFileSystem{}, projectPath, &Scope{Ignore: ignore, Symlinks: options.Symlinks})
+}
+
+// preview simulates the given stages on the project and returns what they
+// would change.
+func (c *CLI) preview(projectPath string, options *Options, stages []string) (Impact, error) {
+	preview, err := NewSimulatedFileSystem(projectPath)
+	if err != nil {
+		return Impact{}, err
+	}
+	quiet := slog.New(slog.NewTextHandler(io.Discard, nil))
+	run := &Run{ProjectPath: projectPath, FileSystem: preview, Options: options, Summary: &Summary{}, Log: quiet, Stages: stages}
+	err = run.Execute()
+	if err != nil {
+		return Impact{}, err
+	}
+	return preview.Impact(), nil
+}
+
+// enforce runs the given stages on the project after the safety checks.
+func (c *CLI) enforce(projectPath string, stages []string) error {
+	settings, err := c.settings(projectPath)
+	if err != nil {
+		return err
+	}
+	options, err := settings.Options()
+	if err != nil {
+		return err
+	}
+	guard, err := c.guard(settings)
+	if err != nil {
+		return err
+	}
+	err = c.checkProject(guard, projectPath, options)
+	if err != nil {
+		return err
+	}
+
+	// Simulate the run first and ask for confirmation before changing anything
+	if !guard.SkipConfirmation {
+		impact, err := c.preview(projectPath, options, stages)
+		if err != nil {
+			return err
+		}
+		err = guard.Confirm(projectPath, impact)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = c.apply(projectPath, settings, stages)
+	return err
+}
+
+// apply runs the given stages on the project with its settings, snapshotting
+// it first if asked to, and returns what happened. Real runs are recorded in
+// the project's log.
+func (c *CLI) apply(projectPath string, settings *Settings, stages []string) (summary *Summary, err error) {
+	summary = &Summary{}
+	text := c.text()
+	if c.events != nil {
+		defer func() {
+			c.events.Emit(summary.Object(projectPath, err))
+		}()
+	}
+
+	// Mark what a dry run logs, nothing it reports has happened
+	log := c.log
+	if c.dryRun {
+		log = log.With("dry_run", true)
+	}
+	var logFile *LogFile
+	if !c.dryRun {
+		runLog, fileLog, file, err := c.projectLog(projectPath)
+		if err != nil {
+			return summary, err
+		}
+		defer file.Close()
+		log, logFile = runLog, file
+
+		fileLog.Info("run started", "project", projectPath, "stages", stages)
+		defer func() {
+			if err != nil {
+				fileLog.Error("run failed", "project", projectPath, "error", err)
+				return
+			}
+			fileLog.Info("run finished", "project", projectPath, "moved", summary.Moved,
+				"conflicts", len(summary.Conflicts), "errors", len(summary.Errors))
+		}()
+	}
+
+	options, err := settings.Options()
+	if err != nil {
+		return summary, err
+	}
+	format, err := ParseSnapshotFormat(settings.Value("snapshot_format"))
+	if err != nil {
+		return summary, settings.invalid("snapshot_format", err)
+	}
+
+	// Archive the project before anything is changed
+	if snapshotDir := settings.Value("snapshot"); snapshotDir != "" && !c.dryRun {
+		snapshot := &Snapshot{FolderPath: projectPath, Dir: snapshotDir, Format: format}
+		archivePath, err := snapshot.Create()
+		if err != nil {
+			return summary, err
+		}
+		log.Info("wrote snapshot", "project", projectPath, "archive", archivePath)
+		if c.events != nil {
+			c.events.Emit(Event{Type: "snapshot", Source: projectPath, Destination: archivePath, Status: "ok"})
+		}
+	}
+
+	defer summary.Print(text)
+
+	// Simulate every operation on an in-memory copy of the tree in dry-run mode,
+	// otherwise record every change in the project's journal
+	var base FileSystem
+	if c.dryRun {
+		plan, err := NewSimulatedFileSystem(projectPath)
+		if err != nil {
+			return summary, err
+		}
+		base = plan
+		defer plan.PrintPlan(text)
+	} else {
+		journal, err := OpenJournal(projectPath)
+		if err != nil {
+			return summary, err
+		}
+		defer journal.Close()
+		base = &JournaledFileSystem{FileSystem: &OSFileSystem{}, journal: journal, open: []projectFile{logFile}}
+	}
+	if c.events != nil {
+		base = &EventFileSystem{FileSystem: base, events: c.events, dryRun: c.dryRun}
+	}
+
+	run := &Run{ProjectPath: projectPath, FileSystem: base, Options: options, Summary: summary, Log: log, Stages: stages}
+	err = run.Execute()
+	if err != nil {
+		return summary, err
+	}
+	if c.dryRun {
+		log.Info("dry run completed successfully, nothing was changed", "project", projectPath)
+		return summary, nil
+	}
+	log.Info("program completed successfully", "project", projectPath)
+	return summary, nil
+}
+
+// workspace runs the given stages on every project in a workspace. A project
+// that fails does not stop the others.
+func (c *CLI) workspace(args []string) error {
+	stages, err := SelectStages(AllStages(), splitList(c.only), splitList(c.skip))
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("usage: enforce workspace <parent>")
+	}
+	parent, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Settings shared by every project are checked once up front
+	settings, err := c.settings("")
+	if err != nil {
+		return err
+	}
+	_, err = settings.Options()
+	if err != nil {
+		return err
+	}
+	guard, err := c.guard(settings)
+	if err != nil {
+		return err
+	}
+	// Never treat the file system root, the home directory or a system
+	// directory as a workspace
+	err = guard.CheckPath(parent)
+	if err != nil {
+		return err
+	}
+
+	projects, err := FindProjects(parent)
+	if err != nil {
+		return err
+	}
+	if len(projects) == 0 {
+		return fmt.Errorf("no projects found in '%s'", parent)
+	}
+
+	// Check every project up front; the ones that fail are reported but
+	// leave the others alone
+	results := make([]*WorkspaceResult, len(projects))
+	projectSettings := make([]*Settings, len(projects))
+	var ready []string
+	var impacts []Impact
+	for i, project := range projects {
+		results[i] = &WorkspaceResult{Project: project}
+		var impact Impact
+		err = guard.CheckPath(project)
+		if err == nil {
+			projectSettings[i], err = c.settings(project)
+		}
+		if err == nil {
+			impact, err = c.checkWorkspaceProject(project, projectSettings[i], stages)
+		}
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		ready = append(ready, project)
+		impacts = append(impacts, impact)
+	}
+	if len(ready) > 0 {
+		err = guard.ConfirmWorkspace(parent, ready, impacts)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		c.log.Info("enforcing project", "project", result.Project)
+		result.Apply(func() (*Summary, error) {
+			return c.apply(result.Project, projectSettings[i], stages)
+		})
+	}
+
+	if c.events != nil {
+		c.events.Emit(WorkspaceObject(parent, results))
+	} else {
+		fmt.Fprintln(c.out)
+		PrintWorkspaceSummary(c.out, results)
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			return fmt.Errorf("enforcing failed for some projects in '%s'", parent)
+		}
+	}
+	return nil
+}
+
+// checkWorkspaceProject runs the safety checks on a project of a workspace
+// with its own settings and, unless confirmation is skipped, returns what the
+// run would change.
+func (c *CLI) checkWorkspaceProject(projectPath string, settings *Settings, stages []string) (Impact, error) {
+	options, err := settings.Options()
+	if err != nil {
+		return Impact{}, err
+	}
+	guard, err := c.guard(settings)
+	if err != nil {
+		return Impact{}, err
+	}
+	err = c.checkProject(guard, projectPath, options)
+	if err != nil || guard.SkipConfirmation {
+		return Impact{}, err
+	}
+	return c.preview(projectPath, options, stages)
+}
+
+// check reports how the project differs from the project structure and fails
+// if it differs at all.
+func (c *CLI) check(args []string) error {
+	projectPath, err := c.projectPath(args)
+	if err != nil {
+		return err
+	}
+	settings, err := c.settings(projectPath)
+	if err != nil {
+		return err
+	}
+	options, err := settings.Options()
+	if err != nil {
+		return err
+	}
+
+	fsys := &OSFileSystem{}
+	ignore, err := LoadIgnoreMatcher(fsys, projectPath, options.UseGitignore)
+	if err != nil {
+		return err
+	}
+	checker := &Checker{
+		FolderPath: projectPath,
+		FileSystem: fsys,
+		Scope:      &Scope{Ignore: ignore, Symlinks: options.Symlinks},
+		Layout:     options.layout(),
+		Rules:      options.rules(),
+		Bundles:    options.bundles(),
+	}
+	err = checker.Execute()
+	if err != nil {
+		return err
+	}
+	if c.events != nil {
+		c.events.Emit(checker.Object())
+	} else {
+		checker.Print(c.out)
+	}
+	if len(checker.Problems) > 0 {
+		return fmt.Errorf("'%s' does not follow the project structure", projectPath)
+	}
+	return nil
+}
+
+// explain prints where a run would put each file and why, without changing
+// anything.
+func (c *CLI) explain(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: enforce explain <file>...")
+	}
+	explainer := &Explainer{Paths: args, FileSystem: &OSFileSystem{}, Settings: c.settings}
+	err := explainer.Execute()
+	if err != nil {
+		return err
+	}
+	if c.events != nil {
+		for _, explanation := range explainer.Explanations {
+			c.events.Emit(explanation.Object())
+		}
+		return nil
+	}
+	explainer.Print(c.out)
+	return nil
+}
+
+// undo reverses the last run using the project's journal.
+func (c *CLI) undo(args []string) error {
+	projectPath, err := c.projectPath(args)
+	if err != nil {
+		return err
+	}
+	log, fileLog, logFile, err := c.projectLog(projectPath)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	fileLog.Info("undo started", "project", projectPath)
+	err = UndoJournal(projectPath, log, logFile)
+	if err != nil {
+		fileLog.Error("undo failed", "project", projectPath, "error", err)
+		return err
+	}
+	log.Info("undo completed successfully", "project", projectPath)
+	return nil
+}
+
+// restore rebuilds a project from a snapshot.
+func (c *CLI) restore(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: enforce restore <snapshot> [path]")
+	}
+	target := ""
+	if len(args) > 1 {
+		target = args[1]
+	}
+	restored, previous, err := RestoreSnapshot(args[0], target)
+	if err != nil {
+		return err
+	}
+	if previous != "" {
+		c.log.Info("moved the current project aside", "project", restored, "destination", previous)
+	}
+	c.log.Info("restored project", "project", restored, "snapshot", args[0])
+	return nil
+}
+
+// presets lists the built-in and user presets.
+func (c *CLI) presets(args []string) error {
+	presets, err := LoadPresets()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	for _, name := range PresetNames(presets) {
+		description := presets[name].Description
+		if name == DefaultPreset {
+			description += " (default)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", name, description)
+	}
+	return tw.Flush()
+}
+
+// config shows the config files of a project, or its effective
+// configuration with --effective.
+func (c *CLI) config(args []string) error {
+	if len(args) == 0 || args[0] != "show" {
+		return errors.New("usage: enforce config show [--effective] [path]")
+	}
+	show := flag.NewFlagSet("config show", flag.ContinueOnError)
+	show.SetOutput(c.out)
+	effective := show.Bool("effective", false, "show the merged configuration and where each value came from")
+	err := show.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+	projectPath := show.Arg(0)
+
+	if !*effective {
+		var paths []string
+		if path, err := userConfigPath(); err == nil {
+			paths = append(paths, path)
+		}
+		if projectPath != "" {
+			paths = append(paths, projectConfigPath(projectPath))
+		}
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				fmt.Fprintf(c.out, "# %s (not found)\n", path)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read config '%s': %w", path, err)
+			}
+			fmt.Fprintf(c.out, "# %s\n%s\n", path, strings.TrimRight(string(data), "\n"))
+		}
+		return nil
+	}
+
+	settings, err := c.settings(projectPath)
+	if err != nil {
+		return err
+	}
+	if c.events != nil {
+		c.events.Emit(settings.Object(projectPath))
+		return nil
+	}
+	return settings.Print(c.out)
+}
@@ -11,27 +11,87 @@ import (
 // FileOperation represents a file operation.
 type FileOperation interface {
 	Execute() error
+	// Inverse returns an operation that reverses what the last call to
+	// Execute did, or nil if there is nothing to reverse.
+	Inverse() FileOperation
+	String() string
+}
+
+// OperationSequence represents file operations executed one after another.
+type OperationSequence []FileOperation
+
+// Execute executes the operations in order, stopping at the first error.
+func (s OperationSequence) Execute() error {
+	for _, op := range s {
+		err := op.Execute()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Inverse returns the inverses of the operations in reverse order.
+func (s OperationSequence) Inverse() FileOperation {
+	var inverse OperationSequence
+	for i := len(s) - 1; i >= 0; i-- {
+		if op := s[i].Inverse(); op != nil {
+			inverse = append(inverse, op)
+		}
+	}
+	return inverse.orNil()
+}
+
+// orNil returns the sequence as a FileOperation, or nil if it is empty.
+func (s OperationSequence) orNil() FileOperation {
+	if len(s) == 0 {
+		return nil
+	}
+	return s
+}
+
+func (s OperationSequence) String() string {
+	return fmt.Sprintf("%d operations", len(s))
 }
 
 // MoveFileOperation represents a move file operation.
 type MoveFileOperation struct {
+	fsys       FileSystem
+	conflicts  *ConflictResolver
 	sourcePath string
 	destPath   string
+	movedPath  string
 }
 
 // Execute executes the move file operation.
 func (m *MoveFileOperation) Execute() error {
-	err := os.Rename(m.sourcePath, m.destPath)
+	movedPath, err := m.conflicts.Move(m.fsys, m.sourcePath, m.destPath)
 	if err != nil {
 		return fmt.Errorf("failed to move file '%s' to '%s': %w", m.sourcePath, m.destPath, err)
 	}
+	m.movedPath = movedPath
 	return nil
 }
 
+// Inverse returns a move back to the original path.
+func (m *MoveFileOperation) Inverse() FileOperation {
+	if m.movedPath == "" || filepath.Clean(m.movedPath) == filepath.Clean(m.sourcePath) {
+		return nil
+	}
+	return &MoveFileOperation{fsys: m.fsys, sourcePath: m.movedPath, destPath: m.sourcePath}
+}
+
+func (m *MoveFileOperation) String() string {
+	return fmt.Sprintf("move '%s' to '%s'", m.sourcePath, m.destPath)
+}
+
 // RenameFileOperation represents a rename file operation.
 type RenameFileOperation struct {
-	filePath string
-	newName  string
+	fsys      FileSystem
+	conflicts *ConflictResolver
+	filePath  string
+	newName   string
+	renamed   string
 }
 
 // Execute executes the rename file operation.
@@ -41,14 +101,27 @@ func (r *RenameFileOperation) Execute() error {
 	newFilePath := filepath.Join(filepath.Dir(oldFilePath), newFileName)
 
 	if oldFilePath != newFilePath {
-		err := os.Rename(oldFilePath, newFilePath)
+		renamed, err := r.conflicts.Move(r.fsys, oldFilePath, newFilePath)
 		if err != nil {
 			return fmt.Errorf("failed to rename file '%s' to '%s': %w", oldFilePath, newFilePath, err)
 		}
+		r.renamed = renamed
 	}
 	return nil
 }
 
+// Inverse returns a move back to the original name.
+func (r *RenameFileOperation) Inverse() FileOperation {
+	if r.renamed == "" {
+		return nil
+	}
+	return &MoveFileOperation{fsys: r.fsys, sourcePath: r.renamed, destPath: r.filePath}
+}
+
+func (r *RenameFileOperation) String() string {
+	return fmt.Sprintf("rename '%s'", r.filePath)
+}
+
 func transformFileName(fileName string) string {
 	fileName = regexp.MustCompile(`[\s-]`).ReplaceAllString(fileName, "_")
 	fileName = strings.ToLower(fileName)
@@ -58,28 +131,76 @@ func transformFileName(fileName string) string {
 
 // CreateDirectoryOperation represents a create directory operation.
 type CreateDirectoryOperation struct {
+	fsys    FileSystem
 	dirPath string
+	created []string
 }
 
 // Execute executes the create directory operation.
 func (c *CreateDirectoryOperation) Execute() error {
-	err := os.MkdirAll(c.dirPath, os.ModePerm)
+	c.created = missingDirectories(c.fsys, c.dirPath)
+	err := c.fsys.MkdirAll(c.dirPath, os.ModePerm)
 	if err != nil {
+		c.created = nil
 		return fmt.Errorf("failed to create directory '%s': %w", c.dirPath, err)
 	}
 	return nil
 }
 
+// Inverse returns the removal of every directory that had to be created.
+func (c *CreateDirectoryOperation) Inverse() FileOperation {
+	var inverse OperationSequence
+	for _, dir := range c.created {
+		inverse = append(inverse, &RemoveDirectoryOperation{fsys: c.fsys, dirPath: dir})
+	}
+	return inverse.orNil()
+}
+
+func (c *CreateDirectoryOperation) String() string {
+	return fmt.Sprintf("create directory '%s'", c.dirPath)
+}
+
+// missingDirectories returns the directories MkdirAll would have to create
+// for path, deepest first.
+func missingDirectories(fsys FileSystem, path string) []string {
+	var missing []string
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := fsys.Lstat(dir); err == nil {
+			break
+		}
+		missing = append(missing, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	return missing
+}
+
 // RemoveDirectoryOperation represents a remove directory operation.
 type RemoveDirectoryOperation struct {
+	fsys    FileSystem
 	dirPath string
+	removed bool
 }
 
 // Execute executes the remove directory operation.
 func (r *RemoveDirectoryOperation) Execute() error {
-	err := os.Remove(r.dirPath)
+	err := r.fsys.Remove(r.dirPath)
 	if err != nil {
 		return fmt.Errorf("failed to remove directory '%s': %w", r.dirPath, err)
 	}
+	r.removed = true
 	return nil
 }
+
+// Inverse returns the creation of the removed directory.
+func (r *RemoveDirectoryOperation) Inverse() FileOperation {
+	if !r.removed {
+		return nil
+	}
+	return &CreateDirectoryOperation{fsys: r.fsys, dirPath: r.dirPath}
+}
+
+func (r *RemoveDirectoryOperation) String() string {
+	return fmt.Sprintf("remove directory '%s'", r.dirPath)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const configFileName = "config"
+
+// Config represents the settings read from a config file.
+type Config struct {
+	// Preset names the preset the other settings start from.
+	Preset string `json:"preset,omitempty"`
+	// Presets defines presets in addition to the built-in and user presets.
+	Presets           map[string]*Preset `json:"presets,omitempty"`
+	Layout            *Layout            `json:"layout,omitempty"`
+	Rules             RuleSet            `json:"rules,omitempty"`
+	Bundles           BundleSet          `json:"bundles,omitempty"`
+	Gitignore         []string           `json:"gitignore,omitempty"`
+	GitignorePatterns []string           `json:"gitignore_patterns,omitempty"`
+
+	// The same settings as the command-line flags of the same name
+	Dedupe         string `json:"dedupe,omitempty"`
+	UseGitignore   *bool  `json:"use_gitignore,omitempty"`
+	Symlinks       string `json:"symlinks,omitempty"`
+	Conflict       string `json:"conflict,omitempty"`
+	MaxFiles       *int   `json:"max_files,omitempty"`
+	MaxSize        string `json:"max_size,omitempty"`
+	Snapshot       string `json:"snapshot,omitempty"`
+	SnapshotFormat string `json:"snapshot_format,omitempty"`
+}
+
+// userConfigPath returns the path of the user's config file.
+func userConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "enforce", configFileName), nil
+}
+
+// projectConfigPath returns the path of the config file of the project at
+// projectPath.
+func projectConfigPath(projectPath string) string {
+	return filepath.Join(projectPath, enforceDirName, configFileName)
+}
+
+// ReadConfig reads the config file at path. A missing file is an empty config.
+func ReadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config '%s': %w", path, err)
+	}
+
+	config := &Config{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config '%s': %w", path, err)
+	}
+	if config.Layout != nil {
+		err = config.Layout.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid config '%s': %w", path, err)
+		}
+	}
+	err = config.Rules.Validate()
+	if err == nil {
+		err = config.Bundles.Validate()
+	}
+	if err == nil {
+		err = validateGitignore(config.Gitignore)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config '%s': %w", path, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConflictPolicy decides what happens when a file is moved onto a path that
+// already exists.
+type ConflictPolicy string
+
+const (
+	// ConflictAbort stops the run at the first conflict.
+	ConflictAbort ConflictPolicy = "abort"
+	// ConflictSkip leaves the conflicting file where it is.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictSuffix adds a numbered suffix to the file name.
+	ConflictSuffix ConflictPolicy = "suffix"
+	// ConflictPrefix prefixes the file name with its parent path.
+	ConflictPrefix ConflictPolicy = "prefix"
+)
+
+// ErrConflict is returned when a move is aborted because of a conflict.
+var ErrConflict = errors.New("destination already exists")
+
+// ParseConflictPolicy parses the name of a conflict policy.
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(name); policy {
+	case ConflictAbort, ConflictSkip, ConflictSuffix, ConflictPrefix:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy '%s' (want abort, skip, suffix or prefix)", name)
+}
+
+// Conflict represents a move whose destination already existed.
+type Conflict struct {
+	Source   string         `json:"source"`
+	Dest     string         `json:"destination"`
+	Resolved string         `json:"resolved,omitempty"`
+	Policy   ConflictPolicy `json:"policy"`
+}
+
+// String describes the conflict and how it was resolved.
+func (c Conflict) String() string {
+	switch {
+	case c.Resolved != "":
+		return fmt.Sprintf("'%s' -> '%s': destination exists, moved to '%s'", c.Source, c.Dest, c.Resolved)
+	case c.Policy == ConflictAbort:
+		return fmt.Sprintf("'%s' -> '%s': destination exists, aborted", c.Source, c.Dest)
+	}
+	return fmt.Sprintf("'%s' -> '%s': destination exists, skipped", c.Source, c.Dest)
+}
+
+// ConflictResolver moves files without ever replacing existing ones, applying
+// its policy when a destination is taken.
+type ConflictResolver struct {
+	Policy  ConflictPolicy
+	Root    string
+	Summary *Summary
+}
+
+// Move moves sourcePath to destPath and returns the path the file ended up
+// at, or an empty string if it was skipped. A nil resolver treats every
+// conflict as an error, which is what reversing a move needs.
+func (c *ConflictResolver) Move(fsys FileSystem, sourcePath, destPath string) (string, error) {
+	err := fsys.Rename(sourcePath, destPath)
+	if err == nil {
+		return destPath, nil
+	}
+	if !errors.Is(err, os.ErrExist) {
+		return "", err
+	}
+	if c == nil {
+		return "", ErrConflict
+	}
+
+	conflict := Conflict{Source: sourcePath, Dest: destPath, Policy: c.Policy}
+	switch c.Policy {
+	case ConflictSkip:
+		err = nil
+	case ConflictSuffix:
+		conflict.Resolved, err = c.moveWithSuffix(fsys, sourcePath, destPath)
+	case ConflictPrefix:
+		conflict.Resolved, err = c.moveWithPrefix(fsys, sourcePath, destPath)
+	default:
+		err = ErrConflict
+	}
+	c.Summary.AddConflict(conflict)
+	return conflict.Resolved, err
+}
+
+// moveWithSuffix moves the file to the first free "<name>_<n><ext>" path.
+func (c *ConflictResolver) moveWithSuffix(fsys FileSystem, sourcePath, destPath string) (string, error) {
+	ext := filepath.Ext(destPath)
+	stem := strings.TrimSuffix(destPath, ext)
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s_%d%s", stem, n, ext)
+		err := fsys.Rename(sourcePath, candidate)
+		if err == nil {
+			return candidate, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+	}
+}
+
+// moveWithPrefix moves the file to a name prefixed with its parent path
+// relative to the root, falling back to a numbered suffix.
+func (c *ConflictResolver) moveWithPrefix(fsys FileSystem, sourcePath, destPath string) (string, error) {
+	parent, err := filepath.Rel(c.Root, filepath.Dir(sourcePath))
+	if err != nil || parent == "." || isParentRelative(parent) {
+		return c.moveWithSuffix(fsys, sourcePath, destPath)
+	}
+
+	prefix := strings.ReplaceAll(parent, string(filepath.Separator), "_")
+	candidate := filepath.Join(filepath.Dir(destPath), prefix+"_"+filepath.Base(destPath))
+	err = fsys.Rename(sourcePath, candidate)
+	if errors.Is(err, os.ErrExist) {
+		return c.moveWithSuffix(fsys, sourcePath, candidate)
+	}
+	if err != nil {
+		return "", err
+	}
+	return candidate, nil
+}
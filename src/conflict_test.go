@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestConflictResolverMove(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   ConflictPolicy
+		taken    []string
+		want     string
+		err      error
+		conflict bool
+	}{
+		{name: "free destination", policy: ConflictAbort, want: "report.pdf"},
+		{name: "abort", policy: ConflictAbort, taken: []string{"report.pdf"}, err: ErrConflict, conflict: true},
+		{name: "skip", policy: ConflictSkip, taken: []string{"report.pdf"}, conflict: true},
+		{name: "suffix", policy: ConflictSuffix, taken: []string{"report.pdf", "report_1.pdf"}, want: "report_2.pdf", conflict: true},
+		{name: "prefix", policy: ConflictPrefix, taken: []string{"report.pdf"}, want: "a_b_report.pdf", conflict: true},
+		{name: "prefix taken too", policy: ConflictPrefix, taken: []string{"report.pdf", "a_b_report.pdf"}, want: "a_b_report_1.pdf", conflict: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			tree := map[string]string{"a/b/report.pdf": "moved"}
+			for _, rel := range tt.taken {
+				tree[rel] = "taken"
+			}
+			writeTree(t, root, tree)
+
+			summary := &Summary{}
+			resolver := &ConflictResolver{Policy: tt.policy, Root: root, Summary: summary}
+			got, err := resolver.Move(&OSFileSystem{}, filepath.Join(root, "a", "b", "report.pdf"), filepath.Join(root, "report.pdf"))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			want := ""
+			if tt.want != "" {
+				want = filepath.Join(root, tt.want)
+			}
+			if got != want {
+				t.Errorf("moved to '%s', want '%s'", got, want)
+			}
+			if conflict := len(summary.Conflicts) > 0; conflict != tt.conflict {
+				t.Errorf("conflicts %v, want a conflict %v", summary.Conflicts, tt.conflict)
+			}
+
+			// Files already there are never replaced
+			wantTree := append([]string{}, tt.taken...)
+			if tt.want == "" {
+				wantTree = append(wantTree, "a/b/report.pdf")
+			} else {
+				wantTree = append(wantTree, tt.want)
+			}
+			assertTree(t, root, wantTree)
+		})
+	}
+}
+
+func TestConflictResolverMoveWithoutPolicy(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"a.txt": "a", "b.txt": "b"})
+
+	var resolver *ConflictResolver
+	_, err := resolver.Move(&OSFileSystem{}, filepath.Join(root, "a.txt"), filepath.Join(root, "b.txt"))
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("error %v, want a conflict", err)
+	}
+	assertTree(t, root, []string{"a.txt", "b.txt"})
+}
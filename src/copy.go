@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// progressThreshold is the size above which copying a file reports progress.
+const progressThreshold = 64 << 20
+
+// crossDeviceMove moves oldPath to newPath when they are on different file
+// systems. Files are copied, synced to disk and verified against the source
+// hash before the source is deleted. It never replaces an existing path.
+func crossDeviceMove(oldPath, newPath string) error {
+	info, err := os.Lstat(oldPath)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(oldPath)
+		if err != nil {
+			return err
+		}
+		err = os.Symlink(target, newPath)
+		if err != nil {
+			return err
+		}
+		return os.Remove(oldPath)
+
+	case info.IsDir():
+		err = os.Mkdir(newPath, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(oldPath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			err = crossDeviceMove(filepath.Join(oldPath, entry.Name()), filepath.Join(newPath, entry.Name()))
+			if err != nil {
+				return err
+			}
+		}
+		err = os.Chtimes(newPath, info.ModTime(), info.ModTime())
+		if err != nil {
+			return err
+		}
+		return os.Remove(oldPath)
+
+	case info.Mode().IsRegular():
+		err = verifiedCopy(oldPath, newPath, info)
+		if err != nil {
+			return fmt.Errorf("failed to copy '%s' to '%s': %w", oldPath, newPath, err)
+		}
+		return os.Remove(oldPath)
+	}
+	return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: fmt.Errorf("cannot copy special file")}
+}
+
+// verifiedCopy copies the regular file at src to the new path dst, keeping its
+// permissions and modification time. The copy is removed if it does not match
+// the source.
+func verifiedCopy(src, dst string, info os.FileInfo) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(dst)
+		}
+	}()
+
+	srcHash := sha256.New()
+	var w io.Writer = out
+	if info.Size() >= progressThreshold {
+		progress := &copyProgress{name: filepath.Base(src), total: info.Size()}
+		defer progress.done()
+		w = io.MultiWriter(out, progress)
+	}
+	_, err = io.Copy(w, io.TeeReader(in, srcHash))
+	if err != nil {
+		return err
+	}
+	err = out.Sync()
+	if err != nil {
+		return err
+	}
+	err = out.Close()
+	if err != nil {
+		return err
+	}
+
+	dstHash, err := hashFile(&OSFileSystem{}, dst)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(srcHash.Sum(nil)) != dstHash {
+		return fmt.Errorf("copy of '%s' does not match the original", src)
+	}
+
+	err = os.Chmod(dst, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// copyProgress prints how much of a large file has been copied to stderr.
+type copyProgress struct {
+	name    string
+	total   int64
+	written int64
+	percent int64
+}
+
+func (p *copyProgress) Write(b []byte) (int, error) {
+	p.written += int64(len(b))
+	percent := p.written * 100 / p.total
+	if percent != p.percent {
+		p.percent = percent
+		fmt.Fprintf(os.Stderr, "\rCopying '%s': %3d%% of %s", p.name, percent, formatBytes(p.total))
+	}
+	return len(b), nil
+}
+
+func (p *copyProgress) done() {
+	if p.written > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+}
@@ -1,9 +1,8 @@
 package main
 
 import (
-	"fmt"
-
-	"github.com/sqweek/dialog"
+	"os"
+	"runtime"
 )
 
 // DirectoryDialogFactory is a factory that creates a directory dialog.
@@ -14,19 +13,22 @@ type Dialog interface {
 	Browse() (string, error)
 }
 
-// CreateDialog creates a new directory dialog.
+// CreateDialog creates the graphical directory dialog when a display is
+// available and the build includes it, and a terminal dialog otherwise.
 func (f *DirectoryDialogFactory) CreateDialog() Dialog {
-	return &DirectoryDialog{}
+	if displayAvailable() {
+		if dialog := newGUIDialog(); dialog != nil {
+			return dialog
+		}
+	}
+	return &TerminalDialog{In: os.Stdin, Out: os.Stdout}
 }
 
-// DirectoryDialog is a directory dialog implementation.
-type DirectoryDialog struct{}
-
-// Browse displays the directory dialog and returns the selected path.
-func (d *DirectoryDialog) Browse() (string, error) {
-	projectPath, err := dialog.Directory().Title("Select project directory").Browse()
-	if err != nil {
-		return "", fmt.Errorf("failed to select project directory: %w", err)
+// displayAvailable reports whether a graphical dialog can be shown.
+func displayAvailable() bool {
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		return true
 	}
-	return projectPath, nil
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
 }
@@ -0,0 +1,26 @@
+//go:build !nodialog
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/sqweek/dialog"
+)
+
+// newGUIDialog returns the graphical directory dialog.
+func newGUIDialog() Dialog {
+	return &DirectoryDialog{}
+}
+
+// DirectoryDialog is a directory dialog implementation.
+type DirectoryDialog struct{}
+
+// Browse displays the directory dialog and returns the selected path.
+func (d *DirectoryDialog) Browse() (string, error) {
+	projectPath, err := dialog.Directory().Title("Select project directory").Browse()
+	if err != nil {
+		return "", fmt.Errorf("failed to select project directory: %w", err)
+	}
+	return projectPath, nil
+}
@@ -0,0 +1,8 @@
+//go:build nodialog
+
+package main
+
+// newGUIDialog returns nil since this build has no graphical directory dialog.
+func newGUIDialog() Dialog {
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// TerminalDialog is a directory dialog that asks for the project directory on
+// the terminal, completing paths with Tab and offering recent projects.
+type TerminalDialog struct {
+	In  *os.File
+	Out io.Writer
+}
+
+// Browse asks for a project directory until a valid one is given and returns it.
+func (d *TerminalDialog) Browse() (string, error) {
+	const prompt = "Project directory: "
+	var out io.Writer = d.Out
+	var readLine func() (string, error)
+
+	fd := int(d.In.Fd())
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return "", fmt.Errorf("failed to read from the terminal: %w", err)
+		}
+		defer term.Restore(fd, state)
+
+		t := term.NewTerminal(struct {
+			io.Reader
+			io.Writer
+		}{d.In, d.Out}, prompt)
+		t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+			if key != '\t' {
+				return "", 0, false
+			}
+			return completeDirectory(t, line, pos)
+		}
+		out = t
+		readLine = t.ReadLine
+	} else {
+		reader := bufio.NewReader(d.In)
+		readLine = func() (string, error) {
+			fmt.Fprint(out, prompt)
+			line, err := reader.ReadString('\n')
+			if err != nil && line == "" {
+				return "", err
+			}
+			return strings.TrimRight(line, "\r\n"), nil
+		}
+	}
+
+	recent := RecentProjects()
+	if len(recent) > 0 {
+		fmt.Fprintln(out, "Recent projects:")
+		for i, project := range recent {
+			fmt.Fprintf(out, "  %d. %s\n", i+1, project)
+		}
+		fmt.Fprintln(out, "Enter a number to pick a recent project, or a path (Tab completes).")
+	} else {
+		fmt.Fprintln(out, "Enter the path of the project directory (Tab completes).")
+	}
+
+	for {
+		line, err := readLine()
+		if errors.Is(err, io.EOF) {
+			return "", errors.New("failed to select project directory: no directory given")
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to select project directory: %w", err)
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		path := filepath.Clean(expandHome(line))
+		if n, err := strconv.Atoi(line); err == nil && n >= 1 && n <= len(recent) {
+			path = recent[n-1]
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			fmt.Fprintf(out, "'%s' does not exist.\n", path)
+			continue
+		}
+		if !info.IsDir() {
+			fmt.Fprintf(out, "'%s' is not a directory.\n", path)
+			continue
+		}
+		return path, nil
+	}
+}
+
+// expandHome replaces a leading ~ with the user's home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// completeDirectory completes the directory name before pos in line. When
+// several directories match, they are listed on w.
+func completeDirectory(w io.Writer, line string, pos int) (string, int, bool) {
+	prefix := line[:pos]
+	dir, partial := filepath.Split(expandHome(prefix))
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", 0, false
+	}
+
+	var matches []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, partial) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(partial, ".")) {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.IsDir() {
+			matches = append(matches, name)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+
+	common := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) == 1 {
+		common += string(filepath.Separator)
+	} else if common == partial {
+		fmt.Fprintln(w, strings.Join(matches, "  "))
+		return "", 0, false
+	}
+
+	completed := prefix + common[len(partial):]
+	return completed + line[pos:], len(completed), true
+}
@@ -1,9 +1,5 @@
 package main
 
-import (
-	"os"
-)
-
 // Directory represents a directory in the file system.
 type Directory struct {
 	path       string
@@ -15,10 +11,15 @@ func (d *Directory) AddOperation(op FileOperation) {
 	d.operations = append(d.operations, op)
 }
 
-// ExecuteOperations executes all file operations in the directory.
+// ExecuteOperations executes all file operations in the directory as a
+// transaction. If one fails, the ones already executed are reversed.
 func (d *Directory) ExecuteOperations() error {
+	return d.executeOperations(&Transaction{})
+}
+
+func (d *Directory) executeOperations(tx *Transaction) error {
 	for _, op := range d.operations {
-		err := op.Execute()
+		err := tx.Execute(op)
 		if err != nil {
 			return err
 		}
@@ -37,14 +38,19 @@ func (r *RecursiveDirectory) AddSubdirectory(dir *RecursiveDirectory) {
 	r.subdirectories = append(r.subdirectories, dir)
 }
 
-// ExecuteOperations executes all file operations in the recursive directory and its subdirectories.
+// ExecuteOperations executes all file operations in the recursive directory and its subdirectories
+// as a single transaction.
 func (r *RecursiveDirectory) ExecuteOperations() error {
-	err := r.Directory.ExecuteOperations()
+	return r.executeOperations(&Transaction{})
+}
+
+func (r *RecursiveDirectory) executeOperations(tx *Transaction) error {
+	err := r.Directory.executeOperations(tx)
 	if err != nil {
 		return err
 	}
 	for _, subdir := range r.subdirectories {
-		err := subdir.ExecuteOperations()
+		err := subdir.executeOperations(tx)
 		if err != nil {
 			return err
 		}
@@ -53,29 +59,10 @@ func (r *RecursiveDirectory) ExecuteOperations() error {
 }
 
 // Helper function to check if a directory is empty
-func isDirectoryEmpty(dirPath string) (bool, error) {
-	f, err := os.Open(dirPath)
+func isDirectoryEmpty(fsys FileSystem, dirPath string) (bool, error) {
+	names, err := fsys.ReadDirNames(dirPath)
 	if err != nil {
 		return false, err
 	}
-	defer f.Close()
-
-	_, err = f.Readdirnames(1)
-	if err == nil {
-		// Directory is not empty
-		return false, nil
-	}
-
-	if err == os.ErrNotExist {
-		// Directory doesn't exist
-		return false, err
-	}
-
-	if err == os.ErrPermission {
-		// Permission denied
-		return false, err
-	}
-
-	// Directory is empty
-	return true, nil
+	return len(names) == 0, nil
 }
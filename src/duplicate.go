@@ -0,0 +1,331 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const quarantineDirName = "quarantine"
+
+// DedupePolicy decides what happens to files whose contents are identical.
+type DedupePolicy string
+
+const (
+	// DedupeOff disables duplicate detection.
+	DedupeOff DedupePolicy = "off"
+	// DedupeReport only reports duplicates.
+	DedupeReport DedupePolicy = "report"
+	// DedupeQuarantine keeps one copy and moves the rest into .enforce/quarantine.
+	DedupeQuarantine DedupePolicy = "quarantine"
+	// DedupeHardlink replaces duplicates with hard links to the kept copy.
+	DedupeHardlink DedupePolicy = "hardlink"
+)
+
+// ParseDedupePolicy parses the name of a dedupe policy.
+func ParseDedupePolicy(name string) (DedupePolicy, error) {
+	switch policy := DedupePolicy(name); policy {
+	case DedupeOff, DedupeReport, DedupeQuarantine, DedupeHardlink:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown dedupe policy '%s' (want off, report, quarantine or hardlink)", name)
+}
+
+// DuplicateGroup represents a set of files with identical contents. The first
+// path is the copy that is kept.
+type DuplicateGroup struct {
+	Hash  string
+	Size  int64
+	Paths []string
+}
+
+// Wasted returns the number of bytes taken up by the redundant copies.
+func (g DuplicateGroup) Wasted() int64 {
+	return g.Size * int64(len(g.Paths)-1)
+}
+
+// Deduplicator represents the template for finding and handling duplicate files.
+type Deduplicator struct {
+	FolderPath string
+	FileSystem FileSystem
+	Scope      *Scope
+	Policy     DedupePolicy
+	Summary    *Summary
+	done       OperationSequence
+}
+
+// Execute finds duplicate files, applies the policy and writes a report next
+// to the project.
+func (d *Deduplicator) Execute() error {
+	d.done = nil
+	if d.Policy == DedupeOff {
+		return nil
+	}
+
+	groups, err := d.findDuplicates()
+	if err != nil {
+		return fmt.Errorf("failed to find duplicates: %w", err)
+	}
+
+	actions := make(map[string]string)
+	for _, group := range groups {
+		keep := group.Paths[0]
+		for _, path := range group.Paths[1:] {
+			action, err := d.resolve(keep, path)
+			if err != nil {
+				return err
+			}
+			actions[path] = action
+		}
+	}
+
+	reportPath := filepath.Join(filepath.Dir(d.FolderPath), filepath.Base(d.FolderPath)+".duplicates.txt")
+	err = d.FileSystem.WriteFile(reportPath, []byte(d.report(groups, actions)), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write duplicate report: %w", err)
+	}
+
+	d.Summary.Duplicates = groups
+	d.Summary.DuplicateReport = reportPath
+	return nil
+}
+
+// findDuplicates groups files by size and then by content hash.
+func (d *Deduplicator) findDuplicates() ([]DuplicateGroup, error) {
+	bySize := make(map[int64][]string)
+	err := walkProject(d.FileSystem, d.FolderPath, d.Scope, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if info.Mode().IsRegular() && info.Size() > 0 {
+			bySize[info.Size()] = append(bySize[info.Size()], path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []DuplicateGroup
+	for size, paths := range bySize {
+		if len(paths) < 2 {
+			continue
+		}
+
+		byHash := make(map[string][]string)
+		for _, path := range paths {
+			hash, err := hashFile(d.FileSystem, path)
+			if err != nil {
+				return nil, err
+			}
+			byHash[hash] = append(byHash[hash], path)
+		}
+
+		for hash, same := range byHash {
+			if len(same) < 2 {
+				continue
+			}
+			sortKeepFirst(same)
+			groups = append(groups, DuplicateGroup{Hash: hash, Size: size, Paths: same})
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Paths[0] < groups[j].Paths[0]
+	})
+	return groups, nil
+}
+
+// sortKeepFirst orders paths so the shallowest, then alphabetically first,
+// copy comes first and is the one kept.
+func sortKeepFirst(paths []string) {
+	sort.Slice(paths, func(i, j int) bool {
+		di := strings.Count(paths[i], string(filepath.Separator))
+		dj := strings.Count(paths[j], string(filepath.Separator))
+		if di != dj {
+			return di < dj
+		}
+		return paths[i] < paths[j]
+	})
+}
+
+// hashFile returns the hex encoded SHA-256 of a file's contents.
+func hashFile(fsys FileSystem, path string) (string, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash '%s': %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// resolve applies the policy to a single duplicate and describes what was done.
+func (d *Deduplicator) resolve(keep, path string) (string, error) {
+	switch d.Policy {
+	case DedupeQuarantine:
+		rel, err := filepath.Rel(d.FolderPath, path)
+		if err != nil {
+			return "", err
+		}
+		dest := filepath.Join(d.FolderPath, enforceDirName, quarantineDirName, rel)
+		mkdirOp := &CreateDirectoryOperation{fsys: d.FileSystem, dirPath: filepath.Dir(dest)}
+		err = mkdirOp.Execute()
+		if err != nil {
+			return "", err
+		}
+		d.done = append(d.done, mkdirOp)
+		moveOp := &MoveFileOperation{fsys: d.FileSystem, sourcePath: path, destPath: dest}
+		err = moveOp.Execute()
+		if err != nil {
+			return "", err
+		}
+		d.done = append(d.done, moveOp)
+		return "quarantined to " + d.display(dest), nil
+
+	case DedupeHardlink:
+		linkOp := &LinkFileOperation{fsys: d.FileSystem, sourcePath: keep, linkPath: path}
+		err := linkOp.Execute()
+		if err != nil {
+			return "", err
+		}
+		d.done = append(d.done, linkOp)
+		return "replaced with a hard link", nil
+	}
+	return "reported", nil
+}
+
+// Inverse returns the operations that move quarantined files back and turn
+// hard links back into copies.
+func (d *Deduplicator) Inverse() FileOperation {
+	return d.done.Inverse()
+}
+
+func (d *Deduplicator) String() string {
+	return fmt.Sprintf("find duplicates in '%s'", d.FolderPath)
+}
+
+func (d *Deduplicator) display(path string) string {
+	rel, err := filepath.Rel(d.FolderPath, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// report formats the duplicate report.
+func (d *Deduplicator) report(groups []DuplicateGroup, actions map[string]string) string {
+	var files int
+	var wasted int64
+	for _, group := range groups {
+		files += len(group.Paths) - 1
+		wasted += group.Wasted()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Duplicate report for '%s' (policy: %s)\n", d.FolderPath, d.Policy)
+	fmt.Fprintf(&b, "%d groups, %d duplicate files, %s wasted\n", len(groups), files, formatBytes(wasted))
+	for _, group := range groups {
+		fmt.Fprintf(&b, "\n%s  %s each, %s wasted\n", group.Hash[:16], formatBytes(group.Size), formatBytes(group.Wasted()))
+		fmt.Fprintf(&b, "  keep  %s\n", d.display(group.Paths[0]))
+		for _, path := range group.Paths[1:] {
+			fmt.Fprintf(&b, "  dup   %s (%s)\n", d.display(path), actions[path])
+		}
+	}
+	return b.String()
+}
+
+// formatBytes formats a byte count for humans.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// LinkFileOperation represents replacing a duplicate with a hard link to the
+// file it duplicates.
+type LinkFileOperation struct {
+	fsys       FileSystem
+	sourcePath string
+	linkPath   string
+}
+
+// Execute replaces the duplicate with a hard link.
+func (l *LinkFileOperation) Execute() error {
+	err := l.fsys.ReplaceWithLink(l.sourcePath, l.linkPath)
+	if err != nil {
+		return fmt.Errorf("failed to link '%s' to '%s': %w", l.linkPath, l.sourcePath, err)
+	}
+	return nil
+}
+
+// Inverse returns turning the link back into a copy.
+func (l *LinkFileOperation) Inverse() FileOperation {
+	return &UnlinkFileOperation{fsys: l.fsys, sourcePath: l.sourcePath, linkPath: l.linkPath}
+}
+
+func (l *LinkFileOperation) String() string {
+	return fmt.Sprintf("link '%s' to '%s'", l.linkPath, l.sourcePath)
+}
+
+// UnlinkFileOperation represents replacing a hard link with an independent
+// copy of the file it links to.
+type UnlinkFileOperation struct {
+	fsys       FileSystem
+	sourcePath string
+	linkPath   string
+}
+
+// Execute removes the link and writes a copy in its place.
+func (u *UnlinkFileOperation) Execute() error {
+	info, err := u.fsys.Stat(u.sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to copy '%s': %w", u.sourcePath, err)
+	}
+	r, err := u.fsys.Open(u.sourcePath)
+	if err != nil {
+		return fmt.Errorf("failed to copy '%s': %w", u.sourcePath, err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return fmt.Errorf("failed to copy '%s': %w", u.sourcePath, err)
+	}
+
+	err = u.fsys.Remove(u.linkPath)
+	if err == nil {
+		err = u.fsys.WriteFile(u.linkPath, data, info.Mode().Perm())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unlink '%s': %w", u.linkPath, err)
+	}
+	return nil
+}
+
+// Inverse returns nil, the copy is not linked again.
+func (u *UnlinkFileOperation) Inverse() FileOperation {
+	return nil
+}
+
+func (u *UnlinkFileOperation) String() string {
+	return fmt.Sprintf("unlink '%s' from '%s'", u.linkPath, u.sourcePath)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupeHardlinkRollback(t *testing.T) {
+	projectPath := t.TempDir()
+	// The duplicates clash when flattened, which rolls the run back
+	writeTree(t, projectPath, map[string]string{"a/notes.txt": "same", "b/notes.txt": "same"})
+
+	run := testRun(projectPath)
+	run.Options.Dedupe = DedupeHardlink
+	run.Options.Conflict = ConflictAbort
+	err := run.Execute()
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("error %v, want a conflict", err)
+	}
+
+	assertTree(t, projectPath, []string{"a/notes.txt", "b/notes.txt"})
+	a, errA := os.Stat(filepath.Join(projectPath, "a", "notes.txt"))
+	b, errB := os.Stat(filepath.Join(projectPath, "b", "notes.txt"))
+	if errA != nil || errB != nil {
+		t.Fatal(errA, errB)
+	}
+	if os.SameFile(a, b) {
+		t.Error("duplicates are still linked after the rollback")
+	}
+}
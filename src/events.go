@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// OutputFormat selects how enforce reports what it does.
+type OutputFormat string
+
+const (
+	// OutputText prints human readable messages.
+	OutputText OutputFormat = "text"
+	// OutputJSON prints one JSON object per line for every operation,
+	// followed by a summary object.
+	OutputJSON OutputFormat = "json"
+)
+
+// ParseOutputFormat parses the name of an output format.
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	switch format := OutputFormat(name); format {
+	case OutputText, OutputJSON:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown output format '%s' (want text or json)", name)
+}
+
+// Event represents a single operation reported in JSON output.
+type Event struct {
+	Type        string `json:"type"`
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+}
+
+// EventLog writes events and summaries as JSON lines.
+type EventLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewEventLog creates an event log writing to w.
+func NewEventLog(w io.Writer) *EventLog {
+	return &EventLog{enc: json.NewEncoder(w)}
+}
+
+// Emit writes v as a single line of JSON.
+func (l *EventLog) Emit(v interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// There is nowhere better to report a failure to write the output itself
+	_ = l.enc.Encode(v)
+}
+
+// EventFileSystem is a FileSystem that emits an event for every change it
+// makes or, in a dry run, plans.
+type EventFileSystem struct {
+	FileSystem
+	events *EventLog
+	dryRun bool
+}
+
+// emit reports the outcome of an operation.
+func (e *EventFileSystem) emit(kind, source, destination string, err error) {
+	event := Event{Type: kind, Source: source, Destination: destination, Status: "ok"}
+	switch {
+	case errors.Is(err, os.ErrExist):
+		event.Status = "conflict"
+		event.Error = err.Error()
+	case err != nil:
+		event.Status = "failed"
+		event.Error = err.Error()
+	case e.dryRun:
+		event.Status = "planned"
+	}
+	e.events.Emit(event)
+}
+
+// Rename renames a file or directory and reports the move.
+func (e *EventFileSystem) Rename(oldPath, newPath string) error {
+	err := e.FileSystem.Rename(oldPath, newPath)
+	if err != nil || filepath.Clean(oldPath) != filepath.Clean(newPath) {
+		e.emit("move", oldPath, newPath, err)
+	}
+	return err
+}
+
+// MkdirAll creates a directory and reports it if it did not exist.
+func (e *EventFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	missing := missingDirectories(e.FileSystem, path)
+	err := e.FileSystem.MkdirAll(path, perm)
+	if err != nil || len(missing) > 0 {
+		e.emit("mkdir", path, "", err)
+	}
+	return err
+}
+
+// Remove removes a file or empty directory and reports it.
+func (e *EventFileSystem) Remove(path string) error {
+	err := e.FileSystem.Remove(path)
+	e.emit("remove", path, "", err)
+	return err
+}
+
+// ReplaceWithLink replaces a file with a hard link and reports it.
+func (e *EventFileSystem) ReplaceWithLink(oldPath, newPath string) error {
+	err := e.FileSystem.ReplaceWithLink(oldPath, newPath)
+	e.emit("link", newPath, oldPath, err)
+	return err
+}
+
+// Symlink creates a symlink and reports it.
+func (e *EventFileSystem) Symlink(target, path string) error {
+	err := e.FileSystem.Symlink(target, path)
+	e.emit("symlink", path, target, err)
+	return err
+}
+
+// WriteFile writes a file and reports it.
+func (e *EventFileSystem) WriteFile(path string, data []byte, perm os.FileMode) error {
+	err := e.FileSystem.WriteFile(path, data, perm)
+	e.emit("write", path, "", err)
+	return err
+}
+
+// InitRepository initializes a Git repository and reports it.
+func (e *EventFileSystem) InitRepository(path string) error {
+	err := e.FileSystem.InitRepository(path)
+	e.emit("gitinit", path, "", err)
+	return err
+}
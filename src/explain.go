@@ -0,0 +1,360 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// NearMiss represents a rule a file almost matched.
+type NearMiss struct {
+	Rule *Rule
+	// Index is the position of the rule in its rule set, from 1.
+	Index int
+	// Reason is the one condition that failed while the others held, or that
+	// an earlier rule won.
+	Reason string
+}
+
+// Explanation represents where a run would put a file and why.
+type Explanation struct {
+	Path    string
+	Project string
+	// Normalized is the name the file gets from the rename stage.
+	Normalized string
+	Content    string
+	// Rule is the rule that matched, nil if none does and the file stays in
+	// the project directory.
+	Rule      *Rule
+	RuleIndex int
+	// Bundle is the bundle the file moves with, if any, and Lead the file
+	// leading it.
+	Bundle *Bundle
+	Lead   string
+	// Destination is the path the file ends up at, relative to the project.
+	Destination string
+	// Kept says why the file is left where it is, if no stage visits it.
+	Kept       string
+	NearMisses []NearMiss
+}
+
+// explainProject holds the plan for every file of a project being explained.
+type explainProject struct {
+	scope   *Scope
+	layout  *Layout
+	rules   RuleSet
+	bundles BundleSet
+	plans   map[string]*SortPlan
+}
+
+// Explainer represents the template for explaining where a full run would
+// put files, without changing anything.
+type Explainer struct {
+	Paths      []string
+	FileSystem FileSystem
+	// Settings returns the effective configuration of a project.
+	Settings     func(projectPath string) (*Settings, error)
+	Explanations []*Explanation
+	projects     map[string]*explainProject
+}
+
+// Execute explains every path. Files are classified as if the flatten and
+// rename stages had moved them into the project directory, and grouped with
+// the rest of their project.
+func (e *Explainer) Execute() error {
+	e.Explanations = nil
+	e.projects = make(map[string]*explainProject)
+	for _, path := range e.Paths {
+		explanation, err := e.explain(path)
+		if err != nil {
+			return fmt.Errorf("failed to explain '%s': %w", path, err)
+		}
+		e.Explanations = append(e.Explanations, explanation)
+	}
+	return nil
+}
+
+func (e *Explainer) explain(path string) (*Explanation, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := e.FileSystem.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("'%s' is a directory", path)
+	}
+
+	projectPath := findProjectRoot(e.FileSystem, filepath.Dir(path))
+	project, err := e.project(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(projectPath, path)
+	if err != nil {
+		return nil, err
+	}
+
+	x := &Explanation{Path: rel, Project: projectPath, Normalized: transformFileName(info.Name())}
+	plan, ok := project.plans[path]
+	if !ok {
+		x.Kept = keptReason(e.FileSystem, project, path, rel, info)
+		return x, nil
+	}
+	x.Content = plan.File.Content()
+	if plan.Sorted() {
+		x.Destination = filepath.Join(plan.Folder, x.Normalized)
+	} else {
+		x.Destination = x.Normalized
+	}
+	if plan.Bundle != nil {
+		x.Bundle, x.Lead = plan.Bundle, filepath.Base(plan.Lead.File.Rel)
+	}
+
+	for i, rule := range project.rules {
+		failed := rule.failures(plan.File, true)
+		switch {
+		case rule == plan.Rule:
+			x.RuleIndex = i + 1
+			x.Rule = rule
+		case len(failed) == 0 && x.Rule != nil && rule.conditions() > 0:
+			x.NearMisses = append(x.NearMisses, NearMiss{Rule: rule, Index: i + 1, Reason: fmt.Sprintf("matches too, but rule %d comes first", x.RuleIndex)})
+		case len(failed) == 1 && rule.conditions() > 1:
+			x.NearMisses = append(x.NearMisses, NearMiss{Rule: rule, Index: i + 1, Reason: failed[0]})
+		case len(failed) == 1 && rule.conditions() == 1:
+			if reason, ok := closeMiss(rule, plan.File, failed[0]); ok {
+				x.NearMisses = append(x.NearMisses, NearMiss{Rule: rule, Index: i + 1, Reason: reason})
+			}
+		}
+	}
+	return x, nil
+}
+
+// closeMiss says why a file failing the only condition of rule still comes
+// close: its content suits an extension the rule wants, its extension suits
+// a content type the rule wants, or a pattern only fails on case.
+func closeMiss(rule *Rule, file *Candidate, failure string) (string, bool) {
+	name := filepath.Base(file.Rel)
+	switch {
+	case len(rule.Extensions) > 0:
+		content := file.Content()
+		if content == "" {
+			return "", false
+		}
+		for extension := range rule.extensions {
+			if !ContentMismatch(extension, content) {
+				return fmt.Sprintf("%s, though the content is %s", failure, content), true
+			}
+		}
+	case len(rule.Content) > 0:
+		extension := strings.ToLower(filepath.Ext(name))
+		if extension == "" {
+			return "", false
+		}
+		for _, content := range rule.Content {
+			if !ContentMismatch(name, content) {
+				return fmt.Sprintf("%s, though the extension is %s", failure, extension), true
+			}
+		}
+	case len(rule.patterns) == 1:
+		p := rule.patterns[0]
+		subject := name
+		if p.path {
+			subject = filepath.ToSlash(file.Rel)
+		}
+		if re, err := regexp.Compile("(?i)" + p.re.String()); err == nil && re.MatchString(subject) {
+			return failure + ", but matches ignoring case", true
+		}
+	}
+	return "", false
+}
+
+// keptReason says why a file the sorter does not visit stays where it is.
+func keptReason(fsys FileSystem, project *explainProject, path, rel string, info os.FileInfo) string {
+	switch {
+	case strings.HasPrefix(filepath.ToSlash(rel), enforceDirName+"/"):
+		return "it is inside the " + enforceDirName + " directory"
+	case project.layout.IsRequiredFile(rel):
+		return "the layout requires it"
+	case isJobIndex(fsys, path):
+		return "it is the index of a solver job"
+	case project.scope.Ignore.Match(rel, false):
+		return "it is ignored by the default patterns, .gitignore or " + enforceIgnoreFileName
+	case info.Mode()&os.ModeSymlink != 0:
+		return fmt.Sprintf("it is a symlink and symlinks is '%s'", project.scope.Symlinks)
+	}
+	return "it is not a regular file"
+}
+
+// project plans where every file of the project at projectPath goes, once.
+func (e *Explainer) project(projectPath string) (*explainProject, error) {
+	if project, ok := e.projects[projectPath]; ok {
+		return project, nil
+	}
+	settings, err := e.Settings(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	options, err := settings.Options()
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := LoadIgnoreMatcher(e.FileSystem, projectPath, options.UseGitignore)
+	if err != nil {
+		return nil, err
+	}
+	project := &explainProject{
+		scope:   &Scope{Ignore: ignore, Symlinks: options.Symlinks},
+		layout:  options.layout(),
+		rules:   options.rules(),
+		bundles: options.bundles(),
+		plans:   make(map[string]*SortPlan),
+	}
+	err = project.rules.Validate()
+	if err == nil {
+		err = project.bundles.Validate()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var plans []*SortPlan
+	err = walkBundled(e.FileSystem, projectPath, project.scope, func(path, rel string, info os.FileInfo, anchor bool) error {
+		if project.layout.IsRequiredFile(rel) || isJobIndex(e.FileSystem, path) {
+			return nil
+		}
+
+		// Ignored files stay where they are, the rest are explained as if
+		// flattened into the project directory
+		if anchor {
+			file := NewCandidate(e.FileSystem, path, rel, info)
+			rule, folder := project.rules.Classify(file)
+			plans = append(plans, &SortPlan{Path: path, File: file, Rule: rule, Folder: folder, Anchor: true})
+			return nil
+		}
+		file := NewCandidate(e.FileSystem, path, transformFileName(info.Name()), info)
+		rule, folder := project.rules.Classify(file)
+		plan := &SortPlan{Path: path, File: file, Rule: rule, Folder: folder}
+		plans = append(plans, plan)
+		project.plans[path] = plan
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	project.layout.GroupPlans(plans)
+	project.bundles.Apply(plans, project.rules)
+
+	e.projects[projectPath] = project
+	return project, nil
+}
+
+// findProjectRoot returns the nearest directory from dir upwards holding a
+// .enforce directory or a Git repository, or dir itself if there is none.
+func findProjectRoot(fsys FileSystem, dir string) string {
+	for current := dir; ; {
+		for _, marker := range []string{enforceDirName, ".git"} {
+			if _, err := fsys.Lstat(filepath.Join(current, marker)); err == nil {
+				return current
+			}
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return dir
+		}
+		current = parent
+	}
+}
+
+// ruleName returns the name of the rule, or its position if it has none.
+func ruleName(rule *Rule, index int) string {
+	if rule.Name == "" {
+		return fmt.Sprintf("rule %d", index)
+	}
+	return fmt.Sprintf("'%s' (rule %d)", rule.Name, index)
+}
+
+// Print writes every explanation to w.
+func (e *Explainer) Print(w io.Writer) {
+	for i, x := range e.Explanations {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "%s\n", filepath.Join(x.Project, x.Path))
+		fmt.Fprintf(w, "  project:     %s\n", x.Project)
+		fmt.Fprintf(w, "  normalized:  %s\n", x.Normalized)
+		if x.Content != "" {
+			fmt.Fprintf(w, "  content:     %s\n", x.Content)
+		}
+		switch {
+		case x.Kept != "":
+			fmt.Fprintf(w, "  kept:        %s\n", x.Kept)
+		case x.Rule != nil:
+			fmt.Fprintf(w, "  rule:        %s -> %s\n", ruleName(x.Rule, x.RuleIndex), x.Rule.Destination)
+		default:
+			fmt.Fprintf(w, "  rule:        none matches\n")
+		}
+		if x.Bundle != nil {
+			fmt.Fprintf(w, "  bundle:      %s led by '%s'\n", x.Bundle, x.Lead)
+		}
+		if x.Destination != "" {
+			fmt.Fprintf(w, "  destination: %s\n", x.Destination)
+		}
+		for _, miss := range x.NearMisses {
+			fmt.Fprintf(w, "  near miss:   %s: %s\n", ruleName(miss.Rule, miss.Index), miss.Reason)
+		}
+	}
+}
+
+// NearMissObject is the JSON form of a near miss.
+type NearMissObject struct {
+	Rule   string `json:"rule"`
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// ExplainObject is the JSON form of an explanation.
+type ExplainObject struct {
+	Type        string           `json:"type"`
+	Path        string           `json:"path"`
+	Project     string           `json:"project"`
+	Normalized  string           `json:"normalized"`
+	Content     string           `json:"content,omitempty"`
+	Rule        string           `json:"rule,omitempty"`
+	RuleIndex   int              `json:"rule_index,omitempty"`
+	Bundle      string           `json:"bundle,omitempty"`
+	Lead        string           `json:"lead,omitempty"`
+	Destination string           `json:"destination,omitempty"`
+	Kept        string           `json:"kept,omitempty"`
+	NearMisses  []NearMissObject `json:"near_misses"`
+}
+
+// Object returns the JSON form of the explanation.
+func (x *Explanation) Object() ExplainObject {
+	obj := ExplainObject{
+		Type:        "explain",
+		Path:        x.Path,
+		Project:     x.Project,
+		Normalized:  x.Normalized,
+		Content:     x.Content,
+		RuleIndex:   x.RuleIndex,
+		Destination: x.Destination,
+		Kept:        x.Kept,
+		NearMisses:  []NearMissObject{},
+	}
+	if x.Rule != nil {
+		obj.Rule = x.Rule.Name
+	}
+	if x.Bundle != nil {
+		obj.Bundle, obj.Lead = x.Bundle.Name, x.Lead
+	}
+	for _, miss := range x.NearMisses {
+		obj.NearMisses = append(obj.NearMisses, NearMissObject{Rule: miss.Rule.Name, Index: miss.Index, Reason: miss.Reason})
+	}
+	return obj
+}
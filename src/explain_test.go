@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExplainerNearMisses(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home)
+	t.Setenv("AppData", home)
+
+	projectPath := t.TempDir()
+	writeTree(t, projectPath, map[string]string{
+		enforceDirName + "/" + configFileName: `{"rules": [
+			{"name": "pdf", "extensions": [".pdf"], "destination": "doc"},
+			{"name": "scans", "content": ["pdf"], "destination": "scans"},
+			{"name": "photos", "glob": "*.JPG", "destination": "img"},
+			{"name": "pdf notes", "extensions": [".txt"], "content": ["pdf"], "destination": "notes"},
+			{"name": "big", "min_size": "1MiB", "destination": "big"}
+		]}`,
+		"report.dat": "%PDF-1.4",
+		"photo.jpg":  "photo",
+		"fake.pdf":   "hello",
+	})
+
+	c := NewCLI(io.Discard)
+	explainer := &Explainer{FileSystem: &OSFileSystem{}, Settings: func(projectPath string) (*Settings, error) {
+		return LoadSettings(projectPath, c.flags)
+	}}
+	tests := []struct {
+		file   string
+		rule   string
+		misses map[int]string
+	}{
+		{"report.dat", "scans", map[int]string{
+			1: "extension '.dat' is not one of .pdf, though the content is pdf",
+			4: "extension '.dat' is not one of .txt",
+		}},
+		{"photo.jpg", "", map[int]string{
+			3: "'photo.jpg' does not match glob '*.JPG', but matches ignoring case",
+		}},
+		{"fake.pdf", "pdf", map[int]string{
+			2: "content is unrecognized, not one of pdf, though the extension is .pdf",
+		}},
+	}
+	for _, tt := range tests {
+		explainer.Paths = []string{filepath.Join(projectPath, tt.file)}
+		err := explainer.Execute()
+		if err != nil {
+			t.Fatal(err)
+		}
+		x := explainer.Explanations[0]
+		rule := ""
+		if x.Rule != nil {
+			rule = x.Rule.Name
+		}
+		if rule != tt.rule {
+			t.Errorf("%s matched rule '%s', want '%s'", tt.file, rule, tt.rule)
+		}
+		misses := make(map[int]string)
+		for _, miss := range x.NearMisses {
+			misses[miss.Index] = miss.Reason
+		}
+		if !reflect.DeepEqual(misses, tt.misses) {
+			t.Errorf("%s near misses %v, want %v", tt.file, misses, tt.misses)
+		}
+	}
+}
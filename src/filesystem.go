@@ -0,0 +1,265 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileSystem is an interface representing the side effects enforce has on a project.
+type FileSystem interface {
+	Stat(path string) (os.FileInfo, error)
+	Lstat(path string) (os.FileInfo, error)
+	ReadDirNames(path string) ([]string, error)
+	Open(path string) (io.ReadCloser, error)
+	Readlink(path string) (string, error)
+	Walk(root string, fn filepath.WalkFunc) error
+	Rename(oldPath, newPath string) error
+	MkdirAll(path string, perm os.FileMode) error
+	Remove(path string) error
+	ReplaceWithLink(oldPath, newPath string) error
+	Symlink(target, path string) error
+	WriteFile(path string, data []byte, perm os.FileMode) error
+	InitRepository(path string) error
+}
+
+// OSFileSystem is a FileSystem implementation backed by the operating system.
+type OSFileSystem struct{}
+
+// Stat returns the file info for path, following symlinks.
+func (o *OSFileSystem) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+// Lstat returns the file info for path without following symlinks.
+func (o *OSFileSystem) Lstat(path string) (os.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+// ReadDirNames returns the sorted names of the entries in a directory.
+func (o *OSFileSystem) ReadDirNames(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Open opens a file for reading.
+func (o *OSFileSystem) Open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+// Readlink returns the target of a symlink.
+func (o *OSFileSystem) Readlink(path string) (string, error) {
+	return os.Readlink(path)
+}
+
+// Walk walks the file tree rooted at root.
+func (o *OSFileSystem) Walk(root string, fn filepath.WalkFunc) error {
+	return filepath.Walk(root, fn)
+}
+
+// Rename renames a file or directory. It never replaces an existing path and
+// fails with an error matching os.ErrExist instead. Renaming a path onto
+// itself does nothing, as on Windows. Moves between file systems fall back to
+// a verified copy followed by deleting the original.
+func (o *OSFileSystem) Rename(oldPath, newPath string) error {
+	if filepath.Clean(oldPath) == filepath.Clean(newPath) {
+		return nil
+	}
+
+	err := renameNoReplace(oldPath, newPath)
+	if errors.Is(err, os.ErrExist) && isCaseOnlyRename(oldPath, newPath) {
+		return os.Rename(oldPath, newPath)
+	}
+	if isCrossDevice(err) {
+		return crossDeviceMove(oldPath, newPath)
+	}
+	return err
+}
+
+// isCaseOnlyRename reports whether renaming oldPath to newPath only changes
+// the case of the name of a file on a case-insensitive file system. Other
+// paths naming the same file, such as hard links, are still conflicts.
+func isCaseOnlyRename(oldPath, newPath string) bool {
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	return oldPath != newPath && strings.EqualFold(oldPath, newPath) && isSameFile(oldPath, newPath)
+}
+
+// TrackingFileSystem is a FileSystem that remembers where every moved path
+// ended up.
+type TrackingFileSystem struct {
+	FileSystem
+	current  map[string]string
+	original map[string]string
+}
+
+// Rename renames a file or directory and tracks its new location.
+func (t *TrackingFileSystem) Rename(oldPath, newPath string) error {
+	err := t.FileSystem.Rename(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+	if t.current == nil {
+		t.current = make(map[string]string)
+		t.original = make(map[string]string)
+	}
+
+	oldPath, newPath = filepath.Clean(oldPath), filepath.Clean(newPath)
+	origin := t.Original(oldPath)
+	// Paths moved into a directory move along with it
+	for moved, current := range t.current {
+		if rel, ok := within(oldPath, current); ok {
+			delete(t.original, current)
+			t.current[moved] = filepath.Join(newPath, rel)
+			t.original[t.current[moved]] = moved
+		}
+	}
+	delete(t.original, oldPath)
+	t.original[newPath] = origin
+	t.current[origin] = newPath
+	return nil
+}
+
+// Original returns where the path that is at current now was before the run.
+func (t *TrackingFileSystem) Original(current string) string {
+	current = filepath.Clean(current)
+	if original, ok := t.original[current]; ok {
+		return original
+	}
+	return t.resolve(current, t.original)
+}
+
+// Current returns where the path that was at original before the run is now.
+func (t *TrackingFileSystem) Current(original string) string {
+	original = filepath.Clean(original)
+	if current, ok := t.current[original]; ok {
+		return current
+	}
+	return t.resolve(original, t.current)
+}
+
+// resolve maps path through the nearest of its directories in moves, or
+// returns it unchanged if none of them moved.
+func (t *TrackingFileSystem) resolve(path string, moves map[string]string) string {
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if moved, ok := moves[dir]; ok {
+			rel, _ := within(dir, path)
+			return filepath.Join(moved, rel)
+		}
+	}
+	return path
+}
+
+// within returns path relative to dir if it lies inside dir.
+func within(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || isParentRelative(rel) {
+		return "", false
+	}
+	return rel, true
+}
+
+// Moved returns the number of paths that are no longer where they started.
+func (t *TrackingFileSystem) Moved() int {
+	var moved int
+	for origin, current := range t.current {
+		if origin != current {
+			moved++
+		}
+	}
+	return moved
+}
+
+// isSameFile reports whether two paths refer to the same file.
+func isSameFile(path1, path2 string) bool {
+	info1, err := os.Lstat(path1)
+	if err != nil {
+		return false
+	}
+	info2, err := os.Lstat(path2)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(info1, info2)
+}
+
+// renameNoReplaceFallback renames without replacing on platforms lacking a
+// native no-replace rename. Files are hard linked and unlinked so the check
+// is atomic; directories are checked and then renamed.
+func renameNoReplaceFallback(oldPath, newPath string) error {
+	info, err := os.Lstat(oldPath)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+	}
+
+	if !info.IsDir() {
+		err = os.Link(oldPath, newPath)
+		if err == nil {
+			return os.Remove(oldPath)
+		}
+		if errors.Is(err, os.ErrExist) {
+			return err
+		}
+	}
+
+	if _, err := os.Lstat(newPath); err == nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrExist}
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+// MkdirAll creates a directory along with any missing parents.
+func (o *OSFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// Remove removes a file or an empty directory.
+func (o *OSFileSystem) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// ReplaceWithLink atomically replaces newPath, whose contents must equal
+// those of oldPath, with a hard link to oldPath.
+func (o *OSFileSystem) ReplaceWithLink(oldPath, newPath string) error {
+	// The link is made in a fresh directory so it cannot clash with a file
+	tmpDir, err := os.MkdirTemp(filepath.Dir(newPath), ".enforce-link-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpPath := filepath.Join(tmpDir, filepath.Base(newPath))
+	err = os.Link(oldPath, tmpPath)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, newPath)
+}
+
+// Symlink creates path as a symlink to target.
+func (o *OSFileSystem) Symlink(target, path string) error {
+	return os.Symlink(target, path)
+}
+
+// WriteFile writes data to a file, creating it if necessary.
+func (o *OSFileSystem) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(path, data, perm)
+}
+
+// InitRepository initializes a Git repository at path.
+func (o *OSFileSystem) InitRepository(path string) error {
+	return exec.Command("git", "-C", path, "init").Run()
+}
@@ -2,64 +2,61 @@ package main
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
-// CreateGitignore creates a .gitignore file in the project path.
-func (f *TextFileFactory) CreateGitignore() error {
-	gitignorePath := filepath.Join(f.ProjectPath, ".gitignore")
-	if _, err := os.Stat(gitignorePath); !os.IsNotExist(err) {
-		return fmt.Errorf(".gitignore already exists in the project path")
-	}
-
-	gitignoreContent := []byte(`
-# Exclude sensitive information and credentials
+// gitignoreFragments holds the named parts a .gitignore is put together from.
+var gitignoreFragments = map[string]string{
+	"enforce": `# Exclude the enforce journal
+.enforce/
+`,
+	"secrets": `# Exclude sensitive information and credentials
 *.env
 *.pem
 *.key
 *.cer
-
-# Exclude configuration files
+`,
+	"config": `# Exclude configuration files
 config/
 settings/
 *.config
-
-# Exclude log files
+`,
+	"logs": `# Exclude log files
 logs/
 *.log
-
-# Exclude temporary files and cache
+`,
+	"temp": `# Exclude temporary files and cache
 tmp/
 cache/
 *.tmp
-
-# Exclude build output
+`,
+	"build": `# Exclude build output
 bin/
 build/
 dist/
 *.exe
 *.dll
 *.o
-
-# Exclude dependency files
+`,
+	"dependencies": `# Exclude dependency files
 node_modules/
 vendor/
 venv/
-
-# Exclude operating system files
+`,
+	"os": `# Exclude operating system files
 .DS_Store
 Thumbs.db
 .idea/
-
-# Exclude personal user files
+`,
+	"personal": `# Exclude personal user files
 .bash_history
 .vimrc
 *.bak
-
-
-# Exclude ANSYS result files
+`,
+	"ansys": `# Exclude ANSYS result files
 *.rst
 *.db
 *.dbb
@@ -102,8 +99,8 @@ Thumbs.db
 *.wdb
 *.wrl
 *.xy
-
-## Core latex/pdflatex auxiliary files:
+`,
+	"latex": `## Core latex/pdflatex auxiliary files:
 *.aux
 *.lof
 *.log
@@ -404,19 +401,91 @@ TSWLatexianTemp*
 # option is specified. Footnotes are the stored in a file with suffix Notes.bib.
 # Uncomment the next line to have this generated file ignored.
 #*Notes.bib
+`,
+	"docs": `# Exclude documentation and notes
+docs/
+`,
+	"go": `# Exclude Go build and test output
+*.test
+*.prof
+coverage.out
+go.work.sum
+`,
+	"python": `# Exclude Python caches and environments
+__pycache__/
+*.py[cod]
+*.egg-info/
+.eggs/
+.pytest_cache/
+.mypy_cache/
+.tox/
+.venv/
+env/
+`,
+	"node": `# Exclude Node.js dependencies and caches
+node_modules/
+npm-debug.log*
+yarn-error.log*
+.npm/
+`,
+	"jupyter": `# Exclude Jupyter checkpoints
+.ipynb_checkpoints/
+`,
+	"models": `# Exclude trained model files
+*.pkl
+*.pt
+*.pth
+*.onnx
+*.joblib
+`,
+}
 
+// defaultGitignore lists the fragments of the default .gitignore in order.
+var defaultGitignore = []string{"enforce", "secrets", "config", "logs", "temp", "build", "dependencies", "os", "personal", "ansys", "latex", "docs"}
 
-# Exclude documentation and notes
-docs/
+// GitignoreFragments returns the names of every .gitignore fragment.
+func GitignoreFragments() []string {
+	var names []string
+	for name := range gitignoreFragments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
 
-# Exclude any other sensitive files or directories
-		
-`)
+// validateGitignore checks that every fragment exists.
+func validateGitignore(fragments []string) error {
+	for _, name := range fragments {
+		if _, ok := gitignoreFragments[name]; !ok {
+			return fmt.Errorf("unknown .gitignore fragment '%s' (want one of %s)", name, strings.Join(GitignoreFragments(), ", "))
+		}
+	}
+	return nil
+}
 
-	err := ioutil.WriteFile(gitignorePath, gitignoreContent, 0644)
+// GitignoreOperation returns the creation of a .gitignore file in the
+// project path from the given fragments, followed by any extra patterns.
+func (f *TextFileFactory) GitignoreOperation(fragments, patterns []string) (FileOperation, error) {
+	gitignorePath := filepath.Join(f.ProjectPath, ".gitignore")
+	if _, err := f.FileSystem.Stat(gitignorePath); !os.IsNotExist(err) {
+		return nil, fmt.Errorf(".gitignore already exists in the project path")
+	}
+	err := validateGitignore(fragments)
 	if err != nil {
-		return fmt.Errorf("failed to create .gitignore file: %w", err)
+		return nil, err
 	}
 
-	return nil
+	var parts []string
+	for _, name := range fragments {
+		parts = append(parts, gitignoreFragments[name])
+	}
+	if len(patterns) > 0 {
+		parts = append(parts, "# Exclude project specific files\n"+strings.Join(patterns, "\n")+"\n")
+	}
+
+	return &CreateFileOperation{
+		fsys:     f.FileSystem,
+		filePath: gitignorePath,
+		content:  []byte(strings.Join(parts, "\n")),
+	}, nil
 }
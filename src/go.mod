@@ -1,7 +1,11 @@
 module enforce
 
-go 1.20
+go 1.21
 
-require github.com/sqweek/dialog v0.0.0-20220809060634-e981b270ebbf
+require (
+	github.com/sqweek/dialog v0.0.0-20220809060634-e981b270ebbf
+	golang.org/x/sys v0.15.0
+	golang.org/x/term v0.15.0
+)
 
 require github.com/TheTitanrain/w32 v0.0.0-20180517000239-4f5cfb03fabf // indirect
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The strategies for grouping the files of a component into subfolders.
+const (
+	// GroupFlat puts every file directly into the component.
+	GroupFlat = "flat"
+	// GroupBasename groups files by their name without the extension.
+	GroupBasename = "basename"
+	// GroupYear and GroupMonth group files by the year, or year and month,
+	// they were last modified.
+	GroupYear  = "year"
+	GroupMonth = "month"
+	// GroupLetter groups files by the first letter of their name.
+	GroupLetter = "letter"
+	// GroupPattern groups files by the first submatch of a regular
+	// expression on their name, or the whole match if it has none.
+	GroupPattern = "pattern"
+	// GroupJobname groups solver files by their ANSYS or LS-DYNA jobname.
+	GroupJobname = "jobname"
+)
+
+// Grouping represents how the files sorted into a component are grouped
+// into subfolders.
+type Grouping struct {
+	Strategy string `json:"strategy"`
+	Pattern  string `json:"pattern,omitempty"`
+	// MinSize is the number of files a group needs before it gets a
+	// subfolder; smaller groups stay in the component. It defaults to 1.
+	MinSize int `json:"min_size,omitempty"`
+	// Runs puts each job into a run folder inside its jobname folder, named
+	// after the time its files were last modified.
+	Runs bool `json:"runs,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Validate checks the strategy and compiles the pattern.
+func (g *Grouping) Validate() error {
+	switch g.Strategy {
+	case GroupFlat, GroupBasename, GroupYear, GroupMonth, GroupLetter, GroupJobname:
+		if g.Pattern != "" {
+			return fmt.Errorf("grouping '%s' does not take a pattern", g.Strategy)
+		}
+	case GroupPattern:
+		re, err := regexp.Compile(g.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid grouping pattern '%s': %w", g.Pattern, err)
+		}
+		g.re = re
+	default:
+		return fmt.Errorf("unknown grouping '%s' (want flat, basename, year, month, letter, pattern or jobname)", g.Strategy)
+	}
+	if g.Runs && g.Strategy != GroupJobname {
+		return fmt.Errorf("grouping '%s' does not take runs", g.Strategy)
+	}
+	if g.MinSize < 0 {
+		return fmt.Errorf("invalid minimum group size %d", g.MinSize)
+	}
+	return nil
+}
+
+// Group returns the subfolder the file goes into, or an empty string if it
+// goes directly into the component.
+func (g *Grouping) Group(file *Candidate) string {
+	name := filepath.Base(file.Rel)
+	var group string
+	switch g.Strategy {
+	case GroupBasename:
+		group = strings.TrimSuffix(name, filepath.Ext(name))
+	case GroupYear:
+		group = file.ModTime.Format("2006")
+	case GroupMonth:
+		group = file.ModTime.Format("2006-01")
+	case GroupLetter:
+		group = letterBucket(name)
+	case GroupJobname:
+		group = file.Jobname()
+	case GroupPattern:
+		if g.re == nil && g.Validate() != nil {
+			return ""
+		}
+		match := g.re.FindStringSubmatch(name)
+		if len(match) > 1 {
+			group = match[1]
+		} else if len(match) == 1 {
+			group = match[0]
+		}
+	}
+
+	group = strings.Trim(group, " .")
+	if strings.ContainsAny(group, `/\`) {
+		return ""
+	}
+	return group
+}
+
+// letterBucket returns the first letter of name in lower case, "0-9" for
+// names starting with a digit and "other" for anything else.
+func letterBucket(name string) string {
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r):
+			return string(unicode.ToLower(r))
+		case unicode.IsDigit(r):
+			return "0-9"
+		}
+		return "other"
+	}
+	return "other"
+}
+
+// minSize returns the number of files a group needs to get a subfolder.
+func (g *Grouping) minSize() int {
+	if g.MinSize < 1 {
+		return 1
+	}
+	return g.MinSize
+}
+
+// SortPlan represents where the sorter puts a file.
+type SortPlan struct {
+	Path string
+	File *Candidate
+	// Rule is the rule that matched, nil if the file stays where it is.
+	Rule *Rule
+	// Folder is the destination relative to the project directory.
+	Folder string
+	// Bundle is the bundle the file moves with, if any, and Lead the file
+	// leading it, which decides where the bundle goes.
+	Bundle *Bundle
+	Lead   *SortPlan
+	// Job is the index of the solver job the file belongs to, if its folder
+	// holds one.
+	Job *JobIndex
+	// Anchor marks a file the project's .gitignore leaves out. It is never
+	// moved, but the bundle it belongs to stays with it.
+	Anchor bool
+}
+
+// Sorted reports whether the file is moved into Folder.
+func (p *SortPlan) Sorted() bool {
+	return !p.Anchor && (p.Rule != nil || p.Bundle != nil)
+}
+
+// Reason describes why the file goes into Folder.
+func (p *SortPlan) Reason() string {
+	if p.Bundle != nil && p.Lead != p {
+		return fmt.Sprintf("%s with '%s'", p.Bundle, filepath.Base(p.Lead.File.Rel))
+	}
+	if p.Bundle != nil && (p.Rule == nil || p.Bundle.Destination != "") {
+		return p.Bundle.String()
+	}
+	return fmt.Sprintf("rule '%s'", p.Rule.Name)
+}
+
+// GroupPlans moves every planned file whose destination is a component with
+// a grouping into the subfolder of its group, if the group is large enough.
+func (l *Layout) GroupPlans(plans []*SortPlan) {
+	groups := make([]string, len(plans))
+	sizes := make(map[string]int)
+	latest := make(map[string]time.Time)
+	jobs := make(map[string]*JobIndex)
+	for i, plan := range plans {
+		grouping := l.Grouping(plan.Folder)
+		if plan.Rule == nil || grouping == nil {
+			continue
+		}
+		if group := grouping.Group(plan.File); group != "" {
+			groups[i] = filepath.Join(plan.Folder, group)
+			sizes[groups[i]]++
+			if plan.File.ModTime.After(latest[groups[i]]) {
+				latest[groups[i]] = plan.File.ModTime
+			}
+		}
+	}
+	for i, plan := range plans {
+		grouping := l.Grouping(plan.Folder)
+		if groups[i] == "" || sizes[groups[i]] < grouping.minSize() {
+			continue
+		}
+		plan.Folder = groups[i]
+		if grouping.Strategy == GroupJobname {
+			if jobs[groups[i]] == nil {
+				jobs[groups[i]] = &JobIndex{Jobname: filepath.Base(groups[i])}
+				if grouping.Runs {
+					jobs[groups[i]].Run = latest[groups[i]]
+				}
+			}
+			plan.Job = jobs[groups[i]]
+			if grouping.Runs {
+				plan.Folder = filepath.Join(groups[i], runFolder(latest[groups[i]]))
+			}
+		}
+	}
+}
+
+// Grouping returns the grouping of the component at rel, relative to the
+// project directory, or nil if it is not a component or has no grouping.
+func (l *Layout) Grouping(rel string) *Grouping {
+	rel = filepath.Clean(rel)
+	var grouping *Grouping
+	l.walk(func(path string, component *Component) {
+		if path == rel {
+			grouping = component.Grouping
+		}
+	})
+	return grouping
+}
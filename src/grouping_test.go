@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGroupPlans(t *testing.T) {
+	layout := &Layout{Components: []*Component{
+		{Name: "doc", Grouping: &Grouping{Strategy: GroupBasename, MinSize: 2}},
+		{Name: "media", Grouping: &Grouping{Strategy: GroupMonth}},
+		{Name: "ref", Grouping: &Grouping{Strategy: GroupLetter}},
+		{Name: "data", Grouping: &Grouping{Strategy: GroupPattern, Pattern: `^(\d{4})_`}},
+		{Name: "job", Grouping: &Grouping{Strategy: GroupJobname, Runs: true}},
+		{Name: "bin"},
+	}}
+	if err := layout.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	may := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	june := time.Date(2024, 6, 2, 10, 0, 0, 0, time.UTC)
+	rule := &Rule{Name: "test"}
+
+	tests := []struct {
+		rel     string
+		content string
+		modTime time.Time
+		folder  string
+		want    string
+	}{
+		// Groups smaller than min_size stay in the component
+		{"paper.tex", "", may, "doc", "doc/paper"},
+		{"paper.pdf", "", may, "doc", "doc/paper"},
+		{"notes.txt", "", may, "doc", "doc"},
+		{"clip.mp4", "", june, "media", "media/2024-06"},
+		{"Zotero.bib", "", may, "ref", "ref/z"},
+		{"1999.bib", "", may, "ref", "ref/0-9"},
+		{"2024_results.csv", "", may, "data", "data/2024"},
+		{"results.csv", "", may, "data", "data"},
+		// Jobs are named after /FILNAME and put into a run folder named
+		// after their latest file
+		{"model.inp", "/FILNAME,beam\n", may, "job", "job/beam/2024-06-02_100000"},
+		{"beam.rst", "", june, "job", "job/beam/2024-06-02_100000"},
+		{"tool.exe", "", may, "bin", "bin"},
+	}
+	var plans []*SortPlan
+	for _, tt := range tests {
+		plans = append(plans, &SortPlan{File: testCandidate(tt.rel, tt.content, tt.modTime), Rule: rule, Folder: tt.folder})
+	}
+	// Files no rule matched are never grouped
+	unmatched := &SortPlan{File: testCandidate("paper.txt", "", may), Folder: "doc"}
+	plans = append(plans, unmatched)
+
+	layout.GroupPlans(plans)
+	for i, tt := range tests {
+		if plans[i].Folder != filepath.FromSlash(tt.want) {
+			t.Errorf("%s grouped into '%s', want '%s'", tt.rel, plans[i].Folder, tt.want)
+		}
+	}
+	if unmatched.Folder != "doc" {
+		t.Errorf("unmatched file grouped into '%s'", unmatched.Folder)
+	}
+	if job := plans[8].Job; job == nil || job != plans[9].Job || job.Jobname != "beam" {
+		t.Errorf("job files share index %v and %v, want one for 'beam'", plans[8].Job, plans[9].Job)
+	}
+}
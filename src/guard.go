@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Guard represents the safety checks that run before a project is changed.
+type Guard struct {
+	// AllowSystem allows enforcing file system roots, home directories and
+	// system directories.
+	AllowSystem bool
+	// MaxFiles and MaxBytes limit the size of the project, zero meaning no limit.
+	MaxFiles int
+	MaxBytes int64
+	// SkipConfirmation applies changes without asking first.
+	SkipConfirmation bool
+	In               io.Reader
+	Out              io.Writer
+}
+
+// CheckPath refuses file system roots, the user's home directory, the
+// directories holding every user's files and anything in system directories.
+func (g *Guard) CheckPath(projectPath string) error {
+	if g.AllowSystem {
+		return nil
+	}
+
+	path, err := filepath.Abs(projectPath)
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	if filepath.Dir(path) == path {
+		return fmt.Errorf("refusing to enforce the file system root '%s' (use -allow-system to override)", path)
+	}
+	if home, err := os.UserHomeDir(); err == nil && samePath(path, home) {
+		return fmt.Errorf("refusing to enforce the home directory '%s' (use -allow-system to override)", path)
+	}
+	for _, dir := range sharedDirectories() {
+		if samePath(path, dir) {
+			return fmt.Errorf("refusing to enforce the system directory '%s' (use -allow-system to override)", path)
+		}
+	}
+	for _, dir := range systemDirectories() {
+		if withinPath(path, dir) {
+			return fmt.Errorf("refusing to enforce '%s' in the system directory '%s' (use -allow-system to override)", path, dir)
+		}
+	}
+	return nil
+}
+
+// samePath reports whether two cleaned absolute paths are the same, ignoring
+// case on Windows.
+func samePath(path1, path2 string) bool {
+	path1, path2 = filepath.Clean(path1), filepath.Clean(path2)
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(path1, path2)
+	}
+	return path1 == path2
+}
+
+// withinPath reports whether the absolute path is dir or lies under it,
+// ignoring case on Windows.
+func withinPath(path, dir string) bool {
+	path, dir = filepath.Clean(path), filepath.Clean(dir)
+	if runtime.GOOS == "windows" {
+		path, dir = strings.ToLower(path), strings.ToLower(dir)
+	}
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && !isParentRelative(rel)
+}
+
+// CheckLimits refuses projects with more files or bytes in scope than the
+// limits allow.
+func (g *Guard) CheckLimits(fsys FileSystem, projectPath string, scope *Scope) error {
+	if g.MaxFiles <= 0 && g.MaxBytes <= 0 {
+		return nil
+	}
+
+	var files int
+	var bytes int64
+	err := walkProject(fsys, projectPath, scope, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		files++
+		bytes += info.Size()
+		if g.MaxFiles > 0 && files > g.MaxFiles {
+			return fmt.Errorf("'%s' has more than %d files (use -max-files to raise the limit or 0 to remove it)", projectPath, g.MaxFiles)
+		}
+		if g.MaxBytes > 0 && bytes > g.MaxBytes {
+			return fmt.Errorf("'%s' holds more than %s (use -max-size to raise the limit or 0 to remove it)", projectPath, formatBytes(g.MaxBytes))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check project size: %w", err)
+	}
+	return nil
+}
+
+// Confirm shows what a run will change and asks the user to type the name of
+// the project directory to go ahead.
+func (g *Guard) Confirm(projectPath string, impact Impact) error {
+	if g.SkipConfirmation {
+		return nil
+	}
+
+	fmt.Fprintf(g.Out, "Enforcing '%s' will:\n", projectPath)
+	fmt.Fprintf(g.Out, "  move %d files\n", impact.FilesMoved)
+	fmt.Fprintf(g.Out, "  change %d file names\n", impact.NamesChanged)
+	fmt.Fprintf(g.Out, "  remove %d directories\n", impact.DirsRemoved)
+	return g.ask(projectPath)
+}
+
+// ConfirmWorkspace shows what a run will change in each project of a
+// workspace and asks the user to type the name of the workspace to go ahead.
+func (g *Guard) ConfirmWorkspace(parent string, projects []string, impacts []Impact) error {
+	if g.SkipConfirmation {
+		return nil
+	}
+
+	fmt.Fprintf(g.Out, "Enforcing %d projects in '%s' will:\n", len(projects), parent)
+	for i, project := range projects {
+		fmt.Fprintf(g.Out, "  %s: move %d files, change %d file names, remove %d directories\n",
+			filepath.Base(project), impacts[i].FilesMoved, impacts[i].NamesChanged, impacts[i].DirsRemoved)
+	}
+	return g.ask(parent)
+}
+
+// ask asks the user to type the base name of path and fails if they do not.
+func (g *Guard) ask(path string) error {
+	name := filepath.Base(filepath.Clean(path))
+	fmt.Fprintf(g.Out, "Type '%s' to continue: ", name)
+
+	answer, err := bufio.NewReader(g.In).ReadString('\n')
+	if err != nil && answer == "" {
+		return fmt.Errorf("no confirmation given (use -yes to skip it)")
+	}
+	if strings.TrimSpace(answer) != name {
+		return fmt.Errorf("confirmation did not match '%s', nothing was changed", name)
+	}
+	return nil
+}
+
+// parseSize parses a byte count such as 500000, 200MB or 10GiB.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	number := strings.TrimRightFunc(s, func(r rune) bool {
+		return r < '0' || r > '9'
+	})
+	unit := strings.ToUpper(strings.TrimSpace(s[len(number):]))
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+
+	multipliers := map[string]int64{
+		"": 1, "B": 1,
+		"K": 1 << 10, "KB": 1 << 10, "KIB": 1 << 10,
+		"M": 1 << 20, "MB": 1 << 20, "MIB": 1 << 20,
+		"G": 1 << 30, "GB": 1 << 30, "GIB": 1 << 30,
+		"T": 1 << 40, "TB": 1 << 40, "TIB": 1 << 40,
+	}
+	multiplier, ok := multipliers[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit '%s' in '%s'", unit, s)
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size '%s' is too large", s)
+	}
+	return n * multiplier, nil
+}
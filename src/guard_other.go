@@ -0,0 +1,22 @@
+//go:build !windows
+
+package main
+
+// systemDirectories returns the directories that hold the operating system,
+// which are refused along with everything under them.
+func systemDirectories() []string {
+	return []string{
+		"/bin", "/boot", "/dev", "/etc", "/lib", "/lib32", "/lib64", "/opt",
+		"/proc", "/run", "/sbin", "/sys", "/usr", "/var",
+		"/Applications", "/Library", "/System",
+	}
+}
+
+// sharedDirectories returns the directories that hold every user's files,
+// which are refused themselves but may hold projects.
+func sharedDirectories() []string {
+	return []string{
+		"/home", "/media", "/mnt", "/root", "/srv", "/tmp",
+		"/Users", "/Volumes", "/private",
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int64
+		wantErr bool
+	}{
+		{s: "500000", want: 500000},
+		{s: "200MB", want: 200 << 20},
+		{s: "10GiB", want: 10 << 30},
+		{s: " 3 kb ", want: 3 << 10},
+		{s: "1T", want: 1 << 40},
+		{s: "8388607TB", want: 8388607 << 40},
+		{s: "8388608TB", wantErr: true},
+		{s: "9223372036854775807", want: 9223372036854775807},
+		{s: "9223372036854775808", wantErr: true},
+		{s: "10XB", wantErr: true},
+		{s: "MB", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d and error %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("system directories differ on Windows")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	tests := []struct {
+		path    string
+		refused bool
+	}{
+		{path: "/", refused: true},
+		{path: home, refused: true},
+		{path: filepath.Join(home, "thesis")},
+		{path: "/home", refused: true},
+		{path: "/home/someone/thesis"},
+		{path: "/etc", refused: true},
+		{path: "/etc/nginx", refused: true},
+		{path: "/usr/local", refused: true},
+		{path: "/var/lib/thesis", refused: true},
+		{path: "/etcetera/thesis"},
+	}
+	guard := &Guard{}
+	for _, tt := range tests {
+		err := guard.CheckPath(tt.path)
+		if (err != nil) != tt.refused {
+			t.Errorf("CheckPath(%q) = %v, want refused %v", tt.path, err, tt.refused)
+		}
+	}
+
+	guard.AllowSystem = true
+	if err := guard.CheckPath("/etc/nginx"); err != nil {
+		t.Errorf("CheckPath refused a system directory with AllowSystem: %v", err)
+	}
+}
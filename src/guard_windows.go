@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// systemDirectories returns the directories that hold the operating system,
+// which are refused along with everything under them.
+func systemDirectories() []string {
+	var dirs []string
+	for _, name := range []string{"SystemRoot", "ProgramFiles", "ProgramFiles(x86)", "ProgramData", "ProgramW6432"} {
+		if dir := os.Getenv(name); dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// sharedDirectories returns the directories that hold every user's files,
+// which are refused themselves but may hold projects.
+func sharedDirectories() []string {
+	if profile := os.Getenv("USERPROFILE"); profile != "" {
+		return []string{filepath.Dir(profile)}
+	}
+	return nil
+}
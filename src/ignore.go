@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const enforceIgnoreFileName = ".enforceignore"
+
+// defaultIgnorePatterns are the version control and dependency directories
+// that are never flattened or sorted.
+var defaultIgnorePatterns = []string{
+	".git/",
+	".hg/",
+	".svn/",
+	".bzr/",
+	"_darcs/",
+	"CVS/",
+	"node_modules/",
+	"bower_components/",
+	"vendor/",
+	"venv/",
+	".venv/",
+	"__pycache__/",
+	".tox/",
+}
+
+// ignoreRule is a single compiled gitignore pattern.
+type ignoreRule struct {
+	negate  bool
+	dirOnly bool
+	re      *regexp.Regexp
+}
+
+// IgnoreMatcher decides which paths in a project are left alone, using
+// gitignore pattern syntax.
+type IgnoreMatcher struct {
+	rules []ignoreRule
+}
+
+// NewIgnoreMatcher creates a matcher holding the built-in default patterns.
+func NewIgnoreMatcher() *IgnoreMatcher {
+	m := &IgnoreMatcher{}
+	for _, pattern := range defaultIgnorePatterns {
+		m.AddPattern(pattern)
+	}
+	return m
+}
+
+// LoadIgnoreMatcher creates a matcher from the built-in defaults, the
+// project's .gitignore if useGitignore is set, and its .enforceignore, in that
+// order of precedence.
+func LoadIgnoreMatcher(fsys FileSystem, projectPath string, useGitignore bool) (*IgnoreMatcher, error) {
+	m := NewIgnoreMatcher()
+	files := []string{enforceIgnoreFileName}
+	if useGitignore {
+		files = []string{".gitignore", enforceIgnoreFileName}
+	}
+
+	for _, name := range files {
+		err := m.addFile(fsys, filepath.Join(projectPath, name))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read '%s': %w", name, err)
+		}
+	}
+	return m, nil
+}
+
+func (m *IgnoreMatcher) addFile(fsys FileSystem, path string) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m.AddPattern(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// AddPattern adds a gitignore pattern. Later patterns take precedence over
+// earlier ones. Blank lines and comments are ignored.
+func (m *IgnoreMatcher) AddPattern(line string) {
+	pattern := strings.TrimRight(line, " \t\r")
+	if strings.HasSuffix(pattern, "\\") {
+		pattern += " "
+	}
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return
+	}
+
+	rule := ignoreRule{}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return
+	}
+
+	// A pattern with a slash before its end is relative to the project root;
+	// any other pattern matches at every level.
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	expr := globToRegexp(pattern)
+	if !anchored && !strings.HasPrefix(pattern, "**") {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return
+	}
+	rule.re = re
+	m.rules = append(m.rules, rule)
+}
+
+// globToRegexp translates gitignore glob syntax into a regular expression.
+func globToRegexp(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '*' && strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case c == '*' && strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// match reports whether the last rule matching rel ignores it.
+func (m *IgnoreMatcher) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(rel) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// Match reports whether the slash separated path rel, relative to the
+// project root, is ignored either itself or through one of its parents.
+func (m *IgnoreMatcher) Match(rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(rel, isDir)
+}
+
+// Scope decides which paths in a project enforce may touch.
+type Scope struct {
+	Ignore   *IgnoreMatcher
+	Symlinks SymlinkPolicy
+}
+
+// isSpecialFile reports whether mode is a socket, pipe, device or other
+// irregular file, which are always left alone.
+func isSpecialFile(mode os.FileMode) bool {
+	return mode&(os.ModeSocket|os.ModeNamedPipe|os.ModeDevice|os.ModeCharDevice|os.ModeIrregular) != 0
+}
+
+// walkProject walks the project tree like FileSystem.Walk but never visits
+// the .enforce directory, anything the scope ignores, special files, or
+// symlinks unless they are moved like regular files.
+func walkProject(fsys FileSystem, root string, scope *Scope, fn filepath.WalkFunc) error {
+	return fsys.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == root {
+			return fn(path, info, err)
+		}
+
+		if info.IsDir() && info.Name() == enforceDirName {
+			return filepath.SkipDir
+		}
+		if scope == nil {
+			return fn(path, info, err)
+		}
+
+		rel, relErr := filepath.Rel(root, path)
+		if relErr == nil && scope.Ignore != nil && scope.Ignore.match(filepath.ToSlash(rel), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isSpecialFile(info.Mode()) {
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 && scope.Symlinks != SymlinkMove {
+			return nil
+		}
+		return fn(path, info, err)
+	})
+}
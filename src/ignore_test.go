@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestLoadIgnoreMatcher(t *testing.T) {
+	projectPath := t.TempDir()
+	writeTree(t, projectPath, map[string]string{
+		".gitignore":          "# results\n*.rst\n!keep.rst\n/build/\ndocs/**/*.pdf\ndata?.csv\n[abc]x.txt\n\\#notes.txt\nfoo/\n",
+		enforceIgnoreFileName: "scratch/\n!important.rst\n",
+	})
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{rel: "model.rst", want: true},
+		{rel: "a/b/model.rst", want: true},
+		{rel: "keep.rst"},
+		{rel: "important.rst"},
+		{rel: "build", isDir: true, want: true},
+		{rel: "build/model.o", want: true},
+		{rel: "src/build", isDir: true},
+		{rel: "docs/a/b/paper.pdf", want: true},
+		{rel: "docs/paper.pdf", want: true},
+		{rel: "other/docs/paper.pdf"},
+		{rel: "data1.csv", want: true},
+		{rel: "data12.csv"},
+		{rel: "ax.txt", want: true},
+		{rel: "dx.txt"},
+		{rel: "#notes.txt", want: true},
+		{rel: "foo"},
+		{rel: "foo", isDir: true, want: true},
+		{rel: "scratch/draft.txt", want: true},
+		{rel: ".git/config", want: true},
+		{rel: "web/node_modules", isDir: true, want: true},
+	}
+
+	m, err := LoadIgnoreMatcher(&OSFileSystem{}, projectPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		if got := m.Match(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("Match(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+
+	// Without the .gitignore only the defaults and .enforceignore apply
+	m, err = LoadIgnoreMatcher(&OSFileSystem{}, projectPath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rel, want := range map[string]bool{"model.rst": false, "scratch/draft.txt": true, ".git/config": true} {
+		if got := m.Match(rel, false); got != want {
+			t.Errorf("without .gitignore Match(%q) = %v, want %v", rel, got, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// jobIndexName is the name of the index written into every job folder, one
+// that only enforce uses so that no file of the user's is taken for it.
+const jobIndexName = ".enforce-job"
+
+// jobIndexHeader starts every job index, followed by the jobname.
+const jobIndexHeader = "Job: "
+
+// runFolderFormat is the layout of the name of a timestamped run folder.
+const runFolderFormat = "2006-01-02_150405"
+
+// inputDeckExtensions lists the extensions of ANSYS and LS-DYNA input decks.
+var inputDeckExtensions = map[string]bool{
+	".inp": true, ".dat": true, ".ans": true, ".mac": true,
+	".k": true, ".key": true, ".dyn": true,
+}
+
+// filnameCommand matches the APDL command setting the jobname in a deck.
+var filnameCommand = regexp.MustCompile(`(?im)^[ \t]*/filn[a-z]*[ \t]*,[ \t]*([^,!\s]+)`)
+
+// isInputDeck reports whether the file named name is a solver input deck.
+func isInputDeck(name string) bool {
+	return inputDeckExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// isJobIndex reports whether the file at path is the index of a job folder,
+// which stays in the folder with the job.
+func isJobIndex(fsys FileSystem, path string) bool {
+	if filepath.Base(path) != jobIndexName {
+		return false
+	}
+	file, err := fsys.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	header := make([]byte, len(jobIndexHeader))
+	_, err = io.ReadFull(file, header)
+	return err == nil && string(header) == jobIndexHeader
+}
+
+// Jobname returns the jobname of a solver file. ANSYS and LS-DYNA name their
+// outputs after the job, so it is the name without the extension, unless an
+// ANSYS input deck sets another one with /FILNAME.
+func (c *Candidate) Jobname() string {
+	if c.jobname == nil {
+		name := filepath.Base(c.Rel)
+		jobname := strings.TrimSuffix(name, filepath.Ext(name))
+		if isInputDeck(name) {
+			if match := filnameCommand.FindStringSubmatch(c.text()); match != nil {
+				jobname = transformFileName(strings.Trim(match[1], `'"`))
+			}
+		}
+		c.jobname = &jobname
+	}
+	return *c.jobname
+}
+
+// runFolder returns the name of the run folder of files last modified at
+// modTime.
+func runFolder(modTime time.Time) string {
+	return modTime.Format(runFolderFormat)
+}
+
+// JobFile represents a file listed in the index of a job folder.
+type JobFile struct {
+	Name string
+	Size int64
+}
+
+// JobIndex represents the index of the files of one run of a solver job.
+type JobIndex struct {
+	Jobname string
+	// Run is the time of the run if the job folder is a run folder.
+	Run     time.Time
+	Decks   []JobFile
+	Outputs []JobFile
+}
+
+// Add lists the file in the index as an input deck or an output.
+func (j *JobIndex) Add(name string, size int64) {
+	if isInputDeck(name) {
+		j.Decks = append(j.Decks, JobFile{Name: name, Size: size})
+	} else {
+		j.Outputs = append(j.Outputs, JobFile{Name: name, Size: size})
+	}
+}
+
+// Bytes returns the contents of the index file.
+func (j *JobIndex) Bytes() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s%s\n", jobIndexHeader, j.Jobname)
+	if !j.Run.IsZero() {
+		fmt.Fprintf(&b, "Run: %s\n", j.Run.Format("2006-01-02 15:04:05"))
+	}
+
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, section := range []struct {
+		title string
+		files []JobFile
+	}{{"Input deck", j.Decks}, {"Outputs", j.Outputs}} {
+		if len(section.files) == 0 {
+			continue
+		}
+		sort.Slice(section.files, func(a, b int) bool { return section.files[a].Name < section.files[b].Name })
+		fmt.Fprintf(tw, "\n%s:\n", section.title)
+		for _, file := range section.files {
+			fmt.Fprintf(tw, "  %s\t%s\n", file.Name, formatBytes(file.Size))
+		}
+	}
+	tw.Flush()
+	return b.Bytes()
+}
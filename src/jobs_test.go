@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsJobIndex(t *testing.T) {
+	index := (&JobIndex{Jobname: "run"}).Bytes()
+	tests := []struct {
+		rel     string
+		content string
+		want    bool
+	}{
+		{"job/run/.enforce-job", string(index), true},
+		{".enforce-job", string(index), true},
+		{"job/run/index.txt", string(index), false},
+		{"doc/index.txt", "An index of my notes\n", false},
+		{"job/run/.enforce-job", "Job", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{tt.rel: tt.content})
+			got := isJobIndex(&OSFileSystem{}, filepath.Join(dir, filepath.FromSlash(tt.rel)))
+			if got != tt.want {
+				t.Errorf("isJobIndex = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobIndexIsRewritten(t *testing.T) {
+	projectPath := t.TempDir()
+	writeTree(t, projectPath, map[string]string{"model.inp": "/PREP7\n", "model.rst": "results"})
+	indexPath := filepath.Join(projectPath, "job", "model", jobIndexName)
+
+	err := testRun(projectPath).Execute()
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	before, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A later output of the job is added to the index
+	writeTree(t, projectPath, map[string]string{"model.db": "database"})
+	err = testRun(projectPath).Execute()
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	after, err := os.ReadFile(indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(before), "model.db") || !strings.Contains(string(after), "model.db") {
+		t.Errorf("index not rewritten:\n%s\nthen:\n%s", before, after)
+	}
+}
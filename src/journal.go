@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	enforceDirName  = ".enforce"
+	journalFileName = "journal"
+	backupDirName   = "backup"
+	// journalRunMarker starts the line the journal opens every run with.
+	journalRunMarker = "# run"
+)
+
+// JournalEntry represents a single change recorded in the journal.
+type JournalEntry struct {
+	Action string
+	Paths  []string
+}
+
+// String formats the entry as a journal line.
+func (e JournalEntry) String() string {
+	fields := []string{e.Action}
+	for _, path := range e.Paths {
+		fields = append(fields, strconv.Quote(path))
+	}
+	return strings.Join(fields, " ")
+}
+
+// parseJournalEntry parses a journal line written by JournalEntry.String.
+func parseJournalEntry(line string) (JournalEntry, error) {
+	action, rest, _ := strings.Cut(line, " ")
+	entry := JournalEntry{Action: action}
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return JournalEntry{}, fmt.Errorf("malformed journal line %q: %w", line, err)
+		}
+		path, _ := strconv.Unquote(quoted)
+		entry.Paths = append(entry.Paths, path)
+		rest = rest[len(quoted):]
+	}
+	return entry, nil
+}
+
+// Journal records the changes applied to a project so they can be undone.
+type Journal struct {
+	dir  string
+	file *os.File
+	seq  int
+}
+
+// OpenJournal opens the journal of the project at projectPath for appending.
+func OpenJournal(projectPath string) (*Journal, error) {
+	projectPath, err := filepath.Abs(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(projectPath, enforceDirName)
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create journal directory '%s': %w", dir, err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, journalFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+
+	j := &Journal{dir: dir, file: file}
+	_, err = fmt.Fprintf(file, "%s %s\n", journalRunMarker, time.Now().Format(time.RFC3339))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write journal: %w", err)
+	}
+	return j, nil
+}
+
+// Record appends an entry to the journal.
+func (j *Journal) Record(action string, paths ...string) error {
+	_, err := fmt.Fprintln(j.file, JournalEntry{Action: action, Paths: paths})
+	if err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return j.file.Sync()
+}
+
+// backupPath returns a fresh path under the journal directory for saving a
+// file that is about to be overwritten.
+func (j *Journal) backupPath() (string, error) {
+	dir := filepath.Join(j.dir, backupDirName)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup directory '%s': %w", dir, err)
+	}
+	j.seq++
+	return filepath.Join(dir, fmt.Sprintf("%d-%d", time.Now().UnixNano(), j.seq)), nil
+}
+
+// Close closes the journal.
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// Reopen opens the journal again after Close, in the project at projectPath,
+// carrying on with the same run.
+func (j *Journal) Reopen(projectPath string) error {
+	dir := filepath.Join(projectPath, enforceDirName)
+	file, err := os.OpenFile(filepath.Join(dir, journalFileName), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	j.dir, j.file = dir, file
+	return nil
+}
+
+// projectFile is a file kept open inside the project directory. Windows
+// cannot rename a directory holding open files, so it is closed while the
+// project directory is renamed and reopened in its new place.
+type projectFile interface {
+	Close() error
+	Reopen(projectPath string) error
+}
+
+// renameProject renames the project directory at oldPath to newPath with
+// rename, closing files first and reopening them wherever the project ends
+// up.
+func renameProject(oldPath, newPath string, files []projectFile, rename func(oldPath, newPath string) error) error {
+	for _, file := range files {
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+	err := rename(oldPath, newPath)
+	projectPath := newPath
+	if err != nil {
+		projectPath = oldPath
+	}
+	for _, file := range files {
+		if reopenErr := file.Reopen(projectPath); reopenErr != nil && err == nil {
+			err = reopenErr
+		}
+	}
+	return err
+}
+
+// JournaledFileSystem is a FileSystem that records every change it makes.
+// Paths are recorded as absolute paths, so the journal can be undone from
+// any directory.
+type JournaledFileSystem struct {
+	FileSystem
+	journal *Journal
+	// open lists the other files kept open inside the project, such as its
+	// log.
+	open []projectFile
+}
+
+// absPath returns path as an absolute path, or unchanged if it cannot.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Rename renames a file or directory and records the move.
+func (j *JournaledFileSystem) Rename(oldPath, newPath string) error {
+	if filepath.Clean(oldPath) == filepath.Clean(newPath) {
+		return j.FileSystem.Rename(oldPath, newPath)
+	}
+	var err error
+	if absPath(oldPath) == filepath.Dir(j.journal.dir) {
+		files := append([]projectFile{j.journal}, j.open...)
+		err = renameProject(absPath(oldPath), absPath(newPath), files, j.FileSystem.Rename)
+	} else {
+		err = j.FileSystem.Rename(oldPath, newPath)
+	}
+	if err != nil {
+		return err
+	}
+	return j.journal.Record("move", absPath(oldPath), absPath(newPath))
+}
+
+// MkdirAll creates a directory and records every directory it had to create.
+func (j *JournaledFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	missing := missingDirectories(j.FileSystem, path)
+	err := j.FileSystem.MkdirAll(path, perm)
+	if err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := j.journal.Record("mkdir", absPath(missing[i])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove removes an empty directory and records it. Files are moved into the
+// journal's backup directory instead so they can be restored.
+func (j *JournaledFileSystem) Remove(path string) error {
+	info, err := j.FileSystem.Lstat(path)
+	if err != nil {
+		return j.FileSystem.Remove(path)
+	}
+
+	if !info.IsDir() {
+		backup, err := j.journal.backupPath()
+		if err != nil {
+			return err
+		}
+		err = j.FileSystem.Rename(path, backup)
+		if err != nil {
+			return err
+		}
+		return j.journal.Record("remove", absPath(path), backup)
+	}
+
+	err = j.FileSystem.Remove(path)
+	if err != nil {
+		return err
+	}
+	return j.journal.Record("rmdir", absPath(path))
+}
+
+// ReplaceWithLink replaces a file with a hard link and records it. Undoing
+// it turns the link back into an independent copy.
+func (j *JournaledFileSystem) ReplaceWithLink(oldPath, newPath string) error {
+	err := j.FileSystem.ReplaceWithLink(oldPath, newPath)
+	if err != nil {
+		return err
+	}
+	return j.journal.Record("link", absPath(oldPath), absPath(newPath))
+}
+
+// Symlink creates a symlink and records it.
+func (j *JournaledFileSystem) Symlink(target, path string) error {
+	err := j.FileSystem.Symlink(target, path)
+	if err != nil {
+		return err
+	}
+	return j.journal.Record("symlink", target, absPath(path))
+}
+
+// WriteFile writes a file and records whether it was created or replaced.
+func (j *JournaledFileSystem) WriteFile(path string, data []byte, perm os.FileMode) error {
+	if _, err := j.FileSystem.Lstat(path); err == nil {
+		backup, err := j.journal.backupPath()
+		if err != nil {
+			return err
+		}
+		err = j.FileSystem.Rename(path, backup)
+		if err != nil {
+			return err
+		}
+		err = j.FileSystem.WriteFile(path, data, perm)
+		if err != nil {
+			return err
+		}
+		return j.journal.Record("replace", absPath(path), backup)
+	}
+
+	err := j.FileSystem.WriteFile(path, data, perm)
+	if err != nil {
+		return err
+	}
+	return j.journal.Record("create", absPath(path))
+}
+
+// InitRepository initializes a Git repository and records it if it is new.
+func (j *JournaledFileSystem) InitRepository(path string) error {
+	_, statErr := j.FileSystem.Lstat(filepath.Join(path, ".git"))
+	err := j.FileSystem.InitRepository(path)
+	if err != nil {
+		return err
+	}
+	if os.IsNotExist(statErr) {
+		return j.journal.Record("gitinit", absPath(path))
+	}
+	return nil
+}
+
+// journalRun holds the line a run opened the journal with and the entries it
+// recorded.
+type journalRun struct {
+	header  string
+	entries []JournalEntry
+}
+
+// readJournal reads the journal at journalPath, split into runs.
+func readJournal(journalPath string) ([]journalRun, error) {
+	file, err := os.Open(journalPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var runs []journalRun
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, journalRunMarker):
+			runs = append(runs, journalRun{header: line})
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			entry, err := parseJournalEntry(line)
+			if err != nil {
+				return nil, err
+			}
+			if len(runs) == 0 {
+				runs = append(runs, journalRun{header: journalRunMarker})
+			}
+			runs[len(runs)-1].entries = append(runs[len(runs)-1].entries, entry)
+		}
+	}
+	return runs, scanner.Err()
+}
+
+// undoEntry reverses a single journal entry.
+func undoEntry(entry JournalEntry) error {
+	// Relative paths depend on the directory the run started from, which
+	// undo cannot know; only the target of a symlink may be relative
+	for i, path := range entry.Paths {
+		if !filepath.IsAbs(path) && !(entry.Action == "symlink" && i == 0) {
+			return fmt.Errorf("refusing to undo %s: '%s' is not an absolute path", entry, path)
+		}
+	}
+
+	switch {
+	case entry.Action == "move" && len(entry.Paths) == 2:
+		return moveBack(entry.Paths[1], entry.Paths[0])
+	case entry.Action == "mkdir" && len(entry.Paths) == 1:
+		return os.Remove(entry.Paths[0])
+	case entry.Action == "rmdir" && len(entry.Paths) == 1:
+		// A directory created there since is just as good
+		err := os.Mkdir(entry.Paths[0], os.ModePerm)
+		if info, statErr := os.Lstat(entry.Paths[0]); errors.Is(err, os.ErrExist) && statErr == nil && info.IsDir() {
+			return nil
+		}
+		return err
+	case entry.Action == "create" && len(entry.Paths) == 1:
+		return os.Remove(entry.Paths[0])
+	case entry.Action == "symlink" && len(entry.Paths) == 2:
+		return os.Remove(entry.Paths[1])
+	case entry.Action == "link" && len(entry.Paths) == 2:
+		return unlinkCopy(entry.Paths[0], entry.Paths[1])
+	case entry.Action == "replace" && len(entry.Paths) == 2:
+		// The file written over the original goes, the original comes back
+		err := os.Remove(entry.Paths[0])
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return moveBack(entry.Paths[1], entry.Paths[0])
+	case entry.Action == "remove" && len(entry.Paths) == 2:
+		return moveBack(entry.Paths[1], entry.Paths[0])
+	case entry.Action == "gitinit" && len(entry.Paths) == 1:
+		return os.RemoveAll(filepath.Join(entry.Paths[0], ".git"))
+	}
+	return fmt.Errorf("unknown journal entry %q", entry)
+}
+
+// moveBack moves a file back to where it was, copying it if it was moved
+// across file systems. Like a forward move it never replaces a file created
+// at the original path since.
+func moveBack(fromPath, toPath string) error {
+	err := renameNoReplace(fromPath, toPath)
+	if errors.Is(err, os.ErrExist) && isCaseOnlyRename(fromPath, toPath) {
+		return os.Rename(fromPath, toPath)
+	}
+	if isCrossDevice(err) {
+		if _, statErr := os.Lstat(toPath); statErr == nil {
+			return &os.LinkError{Op: "rename", Old: fromPath, New: toPath, Err: os.ErrExist}
+		}
+		return crossDeviceMove(fromPath, toPath)
+	}
+	return err
+}
+
+// unlinkCopy replaces the hard link at linkPath with an independent copy of
+// sourcePath.
+func unlinkCopy(sourcePath, linkPath string) error {
+	data, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(linkPath), ".enforce-copy-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(info.Mode().Perm())
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), linkPath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// UndoJournal replays the last run in the journal of the project at
+// projectPath backwards, restoring every change it recorded and logging it to
+// log. Entries that cannot be undone are kept in the journal so the undo can
+// be retried, and earlier runs are kept for the next undo. The files in open
+// are closed while the project directory is moved back.
+func UndoJournal(projectPath string, log *slog.Logger, open ...projectFile) error {
+	root, err := filepath.Abs(projectPath)
+	if err != nil {
+		return err
+	}
+	runs, err := readJournal(filepath.Join(root, enforceDirName, journalFileName))
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no journal found in '%s'", root)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+	// Runs that changed nothing have nothing to undo
+	for len(runs) > 0 && len(runs[len(runs)-1].entries) == 0 {
+		runs = runs[:len(runs)-1]
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("nothing to undo in '%s'", root)
+	}
+	last, earlier := runs[len(runs)-1], runs[:len(runs)-1]
+
+	var failed []JournalEntry
+	var errs []string
+	for i := len(last.entries) - 1; i >= 0; i-- {
+		entry := last.entries[i]
+		var err error
+		if entry.Action == "gitinit" && len(entry.Paths) == 1 && filepath.Clean(entry.Paths[0]) != root {
+			err = fmt.Errorf("refusing to remove the Git repository of '%s', which is not the project", entry.Paths[0])
+		} else if entry.Action == "move" && len(entry.Paths) == 2 && filepath.Clean(entry.Paths[1]) == root {
+			err = renameProject(root, filepath.Clean(entry.Paths[0]), open, func(_, _ string) error {
+				return undoEntry(entry)
+			})
+		} else {
+			err = undoEntry(entry)
+		}
+		if err != nil {
+			failed = append([]JournalEntry{entry}, failed...)
+			errs = append(errs, err.Error())
+			continue
+		}
+
+		// The project directory itself may have been renamed.
+		if entry.Action == "move" && filepath.Clean(entry.Paths[1]) == root {
+			root = filepath.Clean(entry.Paths[0])
+		}
+		log.Info("undid change", "entry", entry.String())
+	}
+
+	// Keep the log, it records the undo as well
+	journalDir := filepath.Join(root, enforceDirName)
+	if len(failed) == 0 && len(earlier) == 0 {
+		for _, name := range []string{journalFileName, backupDirName, quarantineDirName} {
+			err := os.RemoveAll(filepath.Join(journalDir, name))
+			if err != nil {
+				return fmt.Errorf("failed to remove journal: %w", err)
+			}
+		}
+		return nil
+	}
+
+	var remaining strings.Builder
+	if len(failed) > 0 {
+		earlier = append(earlier, journalRun{header: last.header, entries: failed})
+	}
+	for _, run := range earlier {
+		remaining.WriteString(run.header + "\n")
+		for _, entry := range run.entries {
+			remaining.WriteString(entry.String() + "\n")
+		}
+	}
+	err = os.WriteFile(filepath.Join(journalDir, journalFileName), []byte(remaining.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to rewrite journal: %w", err)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to undo %d journal entries:\n%s", len(failed), strings.Join(errs, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// journaledRun runs every stage but gitinit on the project at projectPath,
+// recording every change in its journal.
+func journaledRun(t *testing.T, projectPath string) {
+	t.Helper()
+	journal, err := OpenJournal(projectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	run := testRun(projectPath)
+	run.FileSystem = &JournaledFileSystem{FileSystem: &OSFileSystem{}, journal: journal}
+	err = run.Execute()
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+}
+
+func TestUndoJournal(t *testing.T) {
+	tree := map[string]string{
+		"a/Read Me.txt":   "hello",
+		"b/Some File.pdf": "%PDF-1.4",
+		"b/c/model.inp":   "/PREP7\n",
+		"b/c/model.rst":   "results",
+	}
+	original := []string{"a/Read Me.txt", "b/Some File.pdf", "b/c/model.inp", "b/c/model.rst"}
+	tests := []struct {
+		name    string
+		project string
+		// blocker is a file created at an original path after the run,
+		// which keeps the move back to it from being undone.
+		blocker string
+	}{
+		{name: "undo restores the tree", project: "proj"},
+		{name: "undo renames the project directory back", project: "My Proj"},
+		{name: "undo keeps the entries it cannot undo", project: "proj", blocker: "a/Read Me.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			projectPath := filepath.Join(parent, tt.project)
+			writeTree(t, projectPath, tree)
+			journaledRun(t, projectPath)
+
+			renamedPath := filepath.Join(parent, transformFileName(tt.project))
+			log := slog.New(slog.NewTextHandler(io.Discard, nil))
+			if tt.blocker != "" {
+				blocker := filepath.Join(renamedPath, filepath.FromSlash(tt.blocker))
+				writeTree(t, renamedPath, map[string]string{tt.blocker: "created since"})
+				if err := UndoJournal(renamedPath, log); err == nil {
+					t.Fatal("undo replaced a file created since the run")
+				}
+				data, err := os.ReadFile(blocker)
+				if err != nil || string(data) != "created since" {
+					t.Fatalf("undo changed a file created since the run: %q, %v", data, err)
+				}
+
+				// Once the file is out of the way the rest can be undone
+				if err := os.Remove(blocker); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := UndoJournal(renamedPath, log)
+			if err != nil {
+				t.Fatalf("undo failed: %v", err)
+			}
+			assertTree(t, projectPath, original)
+			if _, err := os.Stat(filepath.Join(projectPath, enforceDirName, journalFileName)); !os.IsNotExist(err) {
+				t.Errorf("journal left behind after a complete undo: %v", err)
+			}
+		})
+	}
+}
+
+func TestJournaledRunReopensProjectFiles(t *testing.T) {
+	parent := t.TempDir()
+	projectPath := filepath.Join(parent, "My Proj")
+	writeTree(t, projectPath, map[string]string{"a/notes.txt": "notes"})
+
+	journal, err := OpenJournal(projectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	logFile, err := OpenLogFile(projectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logFile.Close()
+
+	run := testRun(projectPath)
+	run.FileSystem = &JournaledFileSystem{FileSystem: &OSFileSystem{}, journal: journal, open: []projectFile{logFile}}
+	err = run.Execute()
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	// Both files carry on in the renamed project directory
+	renamedPath := filepath.Join(parent, "my_proj")
+	if _, err := logFile.Write([]byte("after the run\n")); err != nil {
+		t.Errorf("log not reopened: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(renamedPath, enforceDirName, logFileName))
+	if err != nil || string(data) != "after the run\n" {
+		t.Errorf("log holds %q, %v", data, err)
+	}
+	runs, err := readJournal(filepath.Join(renamedPath, enforceDirName, journalFileName))
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("journal holds %v, %v", runs, err)
+	}
+	var moved bool
+	for _, entry := range runs[0].entries {
+		moved = moved || entry.String() == JournalEntry{Action: "move", Paths: []string{projectPath, renamedPath}}.String()
+	}
+	if !moved {
+		t.Errorf("journal holds %v, want the move of the project directory", runs[0].entries)
+	}
+}
+
+func TestUndoJournalRefusesRelativePaths(t *testing.T) {
+	projectPath := t.TempDir()
+	writeTree(t, projectPath, map[string]string{
+		"moved.txt":                            "moved",
+		enforceDirName + "/" + journalFileName: "# run\nmove \"proj/a.txt\" \"proj/moved.txt\"\ngitinit \"proj\"\n",
+	})
+
+	err := UndoJournal(projectPath, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil {
+		t.Fatal("undo replayed relative journal entries")
+	}
+	assertTree(t, projectPath, []string{"moved.txt"})
+	runs, err := readJournal(filepath.Join(projectPath, enforceDirName, journalFileName))
+	if err != nil || len(runs) != 1 || len(runs[0].entries) != 2 {
+		t.Errorf("journal holds %v, %v, want both entries kept", runs, err)
+	}
+}
+
+func TestUndoJournalUndoesLastRun(t *testing.T) {
+	projectPath := t.TempDir()
+	writeTree(t, projectPath, map[string]string{"a/first.txt": "1"})
+	journaledRun(t, projectPath)
+	writeTree(t, projectPath, map[string]string{"b/second.txt": "2"})
+	journaledRun(t, projectPath)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// Each undo takes back one run, the last one first
+	err := UndoJournal(projectPath, log)
+	if err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectPath, "b", "second.txt")); err != nil {
+		t.Errorf("second run not undone: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectPath, "doc", "first", "first.txt")); err != nil {
+		t.Errorf("first run undone as well: %v", err)
+	}
+
+	err = UndoJournal(projectPath, log)
+	if err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	assertTree(t, projectPath, []string{"a/first.txt", "b/second.txt"})
+}
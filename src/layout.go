@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Layout represents the directories a project is scaffolded with and the
+// files they must contain.
+type Layout struct {
+	Components []*Component `json:"components"`
+}
+
+// Component represents a directory of a layout, its nested directories and
+// the files it must contain.
+type Component struct {
+	Name       string        `json:"name"`
+	Components []*Component  `json:"components,omitempty"`
+	Files      []*LayoutFile `json:"files,omitempty"`
+	// Grouping decides how files sorted into the component are grouped into
+	// subfolders, none if it is nil.
+	Grouping *Grouping `json:"grouping,omitempty"`
+}
+
+// LayoutFile represents a file a component must contain. It is created with
+// Content when it is missing and never overwritten.
+type LayoutFile struct {
+	Name    string `json:"name"`
+	Content string `json:"content,omitempty"`
+}
+
+// DefaultLayout returns the layout used when no config declares one.
+func DefaultLayout() *Layout {
+	return &Layout{Components: []*Component{
+		{Name: "doc", Components: []*Component{{Name: "report"}}, Grouping: &Grouping{Strategy: GroupBasename}},
+		{Name: "src", Grouping: &Grouping{Strategy: GroupBasename}},
+		{Name: "job", Grouping: &Grouping{Strategy: GroupJobname}},
+		{Name: "data"},
+		{Name: "ref"},
+		{Name: "media", Grouping: &Grouping{Strategy: GroupBasename}},
+		{Name: "bin"},
+	}}
+}
+
+// Validate checks that every component and file has a plain, unique name.
+func (l *Layout) Validate() error {
+	if len(l.Components) == 0 {
+		return fmt.Errorf("layout has no components")
+	}
+	return validateComponents(l.Components, "")
+}
+
+func validateComponents(components []*Component, parent string) error {
+	names := make(map[string]bool)
+	for _, component := range components {
+		err := validateLayoutName(component.Name, parent, names)
+		if err != nil {
+			return err
+		}
+		rel := filepath.Join(parent, component.Name)
+		if component.Grouping != nil {
+			err := component.Grouping.Validate()
+			if err != nil {
+				return fmt.Errorf("invalid grouping of '%s': %w", rel, err)
+			}
+		}
+		for _, file := range component.Files {
+			err := validateLayoutName(file.Name, rel, names)
+			if err != nil {
+				return err
+			}
+		}
+		err = validateComponents(component.Components, rel)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateLayoutName checks that name is a single path element not already
+// used in parent.
+func validateLayoutName(name, parent string, names map[string]bool) error {
+	path := filepath.Join(parent, name)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid layout name '%s' in '%s'", name, parent)
+	}
+	if names[path] {
+		return fmt.Errorf("layout declares '%s' twice", path)
+	}
+	names[path] = true
+	return nil
+}
+
+// Directories returns the path of every component relative to the project
+// directory, parents first.
+func (l *Layout) Directories() []string {
+	var dirs []string
+	l.walk(func(rel string, component *Component) {
+		dirs = append(dirs, rel)
+	})
+	return dirs
+}
+
+// Files returns the path of every required file relative to the project
+// directory.
+func (l *Layout) Files() []string {
+	var files []string
+	l.walk(func(rel string, component *Component) {
+		for _, file := range component.Files {
+			files = append(files, filepath.Join(rel, file.Name))
+		}
+	})
+	return files
+}
+
+// IsRequiredFile reports whether rel, relative to the project directory, is
+// a file the layout requires.
+func (l *Layout) IsRequiredFile(rel string) bool {
+	rel = filepath.Clean(rel)
+	for _, file := range l.Files() {
+		if file == rel {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls fn for every component, parents first.
+func (l *Layout) walk(fn func(rel string, component *Component)) {
+	var visit func(components []*Component, parent string)
+	visit = func(components []*Component, parent string) {
+		for _, component := range components {
+			rel := filepath.Join(parent, component.Name)
+			fn(rel, component)
+			visit(component.Components, rel)
+		}
+	}
+	visit(l.Components, "")
+}
+
+// Scaffold adds operations creating every component of the layout to the
+// project directory, and a subdirectory for each creating its nested
+// components and missing files.
+func (l *Layout) Scaffold(fsys FileSystem, projectDir *RecursiveDirectory) {
+	l.scaffold(fsys, projectDir, l.Components)
+}
+
+func (l *Layout) scaffold(fsys FileSystem, dir *RecursiveDirectory, components []*Component) {
+	for _, component := range components {
+		path := filepath.Join(dir.path, component.Name)
+		dir.AddOperation(&CreateDirectoryOperation{fsys: fsys, dirPath: path})
+
+		componentDir := &RecursiveDirectory{Directory: &Directory{path: path}}
+		for _, file := range component.Files {
+			componentDir.AddOperation(&CreateFileOperation{fsys: fsys, filePath: filepath.Join(path, file.Name), content: []byte(file.Content)})
+		}
+		l.scaffold(fsys, componentDir, component.Components)
+		dir.AddSubdirectory(componentDir)
+	}
+}
+
+// CreateFileOperation represents a create file operation that leaves
+// existing files alone.
+type CreateFileOperation struct {
+	fsys     FileSystem
+	filePath string
+	content  []byte
+	created  bool
+}
+
+// Execute creates the file if it does not exist.
+func (c *CreateFileOperation) Execute() error {
+	c.created = false
+	if _, err := c.fsys.Lstat(c.filePath); !os.IsNotExist(err) {
+		return nil
+	}
+	err := c.fsys.WriteFile(c.filePath, c.content, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create file '%s': %w", c.filePath, err)
+	}
+	c.created = true
+	return nil
+}
+
+// Inverse returns the removal of the file if it was created.
+func (c *CreateFileOperation) Inverse() FileOperation {
+	if !c.created {
+		return nil
+	}
+	return &RemoveFileOperation{fsys: c.fsys, filePath: c.filePath}
+}
+
+func (c *CreateFileOperation) String() string {
+	return fmt.Sprintf("create file '%s'", c.filePath)
+}
+
+// WriteFileOperation represents a write file operation that replaces the
+// file if it exists, keeping its content so the write can be reversed.
+type WriteFileOperation struct {
+	fsys     FileSystem
+	filePath string
+	content  []byte
+	previous []byte
+	existed  bool
+	written  bool
+}
+
+// Execute writes the file unless it already holds the content.
+func (w *WriteFileOperation) Execute() error {
+	w.existed, w.written = false, false
+	if _, err := w.fsys.Lstat(w.filePath); err == nil {
+		r, err := w.fsys.Open(w.filePath)
+		if err != nil {
+			return fmt.Errorf("failed to read file '%s': %w", w.filePath, err)
+		}
+		w.previous, err = io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read file '%s': %w", w.filePath, err)
+		}
+		w.existed = true
+		if bytes.Equal(w.previous, w.content) {
+			return nil
+		}
+	}
+	err := w.fsys.WriteFile(w.filePath, w.content, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write file '%s': %w", w.filePath, err)
+	}
+	w.written = true
+	return nil
+}
+
+// Inverse returns writing back the previous content, or the removal of the
+// file if it was created.
+func (w *WriteFileOperation) Inverse() FileOperation {
+	switch {
+	case !w.written:
+		return nil
+	case w.existed:
+		return &WriteFileOperation{fsys: w.fsys, filePath: w.filePath, content: w.previous}
+	}
+	return &RemoveFileOperation{fsys: w.fsys, filePath: w.filePath}
+}
+
+func (w *WriteFileOperation) String() string {
+	return fmt.Sprintf("write file '%s'", w.filePath)
+}
+
+// RemoveFileOperation represents a remove file operation.
+type RemoveFileOperation struct {
+	fsys     FileSystem
+	filePath string
+}
+
+// Execute removes the file.
+func (r *RemoveFileOperation) Execute() error {
+	err := r.fsys.Remove(r.filePath)
+	if err != nil {
+		return fmt.Errorf("failed to remove file '%s': %w", r.filePath, err)
+	}
+	return nil
+}
+
+// Inverse returns nil, the contents of a removed file are not kept.
+func (r *RemoveFileOperation) Inverse() FileOperation {
+	return nil
+}
+
+func (r *RemoveFileOperation) String() string {
+	return fmt.Sprintf("remove file '%s'", r.filePath)
+}
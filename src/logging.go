@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+const (
+	logFileName = "log"
+	// maxLogSize is the size at which the log file is rotated.
+	maxLogSize = 1 << 20
+	// maxLogFiles is the number of rotated log files kept.
+	maxLogFiles = 5
+)
+
+// newConsoleHandler creates a handler that writes records at level or above
+// to w without timestamps.
+func newConsoleHandler(w io.Writer, level slog.Level) slog.Handler {
+	return slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+}
+
+// teeHandler is a slog.Handler that passes every record to several handlers.
+type teeHandler []slog.Handler
+
+func (t teeHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range t {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t teeHandler) Handle(ctx context.Context, r slog.Record) error {
+	var firstErr error
+	for _, h := range t {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, r.Clone()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (t teeHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (t teeHandler) WithGroup(name string) slog.Handler {
+	handlers := make(teeHandler, len(t))
+	for i, h := range t {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+// LogFile is the log file of a project.
+type LogFile struct {
+	file *os.File
+}
+
+func (l *LogFile) Write(p []byte) (int, error) {
+	return l.file.Write(p)
+}
+
+// Close closes the log file.
+func (l *LogFile) Close() error {
+	return l.file.Close()
+}
+
+// Reopen opens the log file again after Close, in the project at
+// projectPath.
+func (l *LogFile) Reopen(projectPath string) error {
+	reopened, err := OpenLogFile(projectPath)
+	if err != nil {
+		return err
+	}
+	l.file = reopened.file
+	return nil
+}
+
+// OpenLogFile opens the log file of the project at projectPath for
+// appending, rotating it first if it has grown too large.
+func OpenLogFile(projectPath string) (*LogFile, error) {
+	dir := filepath.Join(projectPath, enforceDirName)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create log directory '%s': %w", dir, err)
+	}
+
+	path := filepath.Join(dir, logFileName)
+	if info, err := os.Stat(path); err == nil && info.Size() >= maxLogSize {
+		err = rotateLogFiles(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rotate log: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log: %w", err)
+	}
+	return &LogFile{file: file}, nil
+}
+
+// rotateLogFiles renames path to path.1, path.1 to path.2 and so on, dropping
+// the oldest.
+func rotateLogFiles(path string) error {
+	err := os.Remove(fmt.Sprintf("%s.%d", path, maxLogFiles))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := maxLogFiles - 1; i >= 1; i-- {
+		err = os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(path, path+".1")
+}
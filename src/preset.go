@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultPreset is the preset used when none is selected.
+const DefaultPreset = "simulation"
+
+// Preset represents a named bundle of a layout, classification rules and
+// .gitignore fragments suited to one kind of project.
+type Preset struct {
+	Description string `json:"description,omitempty"`
+	// Extends names a preset whose settings fill in the ones this one leaves
+	// out.
+	Extends string    `json:"extends,omitempty"`
+	Layout  *Layout   `json:"layout,omitempty"`
+	Rules   RuleSet   `json:"rules,omitempty"`
+	Bundles BundleSet `json:"bundles,omitempty"`
+	// Gitignore lists the .gitignore fragments, GitignorePatterns extra
+	// patterns added after them.
+	Gitignore         []string `json:"gitignore,omitempty"`
+	GitignorePatterns []string `json:"gitignore_patterns,omitempty"`
+}
+
+// Validate checks every setting of the preset.
+func (p *Preset) Validate() error {
+	if p.Layout != nil {
+		err := p.Layout.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	err := p.Rules.Validate()
+	if err != nil {
+		return err
+	}
+	err = p.Bundles.Validate()
+	if err != nil {
+		return err
+	}
+	return validateGitignore(p.Gitignore)
+}
+
+// builtinPresets returns the presets enforce ships with.
+func builtinPresets() map[string]*Preset {
+	documents := []string{ContentPDF, ContentDOCX, ContentPPTX}
+	images := []string{".png", ".jpg", ".jpeg", ".gif", ".svg", ".eps", ".tif", ".tiff", ".webp"}
+	scripts := []string{".sh", ".bash", ".ps1", ".bat", ".cmd"}
+
+	return map[string]*Preset{
+		"simulation": {
+			Description: "ANSYS, LS-DYNA and LaTeX engineering projects",
+			Layout:      DefaultLayout(),
+			Rules:       DefaultRules(),
+			Bundles:     DefaultBundles(),
+			Gitignore:   defaultGitignore,
+		},
+		"content": {
+			Description: "the simulation preset, sorting files by their content first and LS-DYNA results as jobs",
+			Extends:     "simulation",
+			Rules:       contentRules(),
+		},
+		"paper": {
+			Description: "a LaTeX paper with its figures, data and references",
+			Layout: &Layout{Components: []*Component{
+				{Name: "tex", Grouping: &Grouping{Strategy: GroupFlat}},
+				{Name: "figures", Grouping: &Grouping{Strategy: GroupFlat}},
+				{Name: "data", Grouping: &Grouping{Strategy: GroupBasename, MinSize: 2}},
+				{Name: "ref", Grouping: &Grouping{Strategy: GroupFlat}},
+				{Name: "notes", Grouping: &Grouping{Strategy: GroupFlat}},
+			}},
+			Rules: RuleSet{
+				{Name: "latex", Extensions: []string{".tex", ".bib", ".bst", ".cls", ".sty", ".bbx", ".cbx"}, Destination: "tex"},
+				{Name: "figures", Extensions: images, Destination: "figures"},
+				{Name: "references", Extensions: []string{".pdf", ".djvu", ".epub"}, Destination: "ref"},
+				{Name: "references by content", Content: documents, Destination: "ref"},
+				{Name: "notes", Extensions: []string{".md", ".txt", ".org", ".docx"}, Destination: "notes"},
+				{Name: "data", Destination: "data"},
+			},
+			// Keep a compiled paper with its source rather than the references
+			Bundles:   BundleSet{{Name: "latex", Extensions: []string{".tex", ".pdf", ".bib"}}},
+			Gitignore: []string{"enforce", "secrets", "temp", "os", "personal", "latex"},
+		},
+		"software": {
+			Description: "a code base; files no rule knows stay in place",
+			Layout: &Layout{Components: []*Component{
+				{Name: "src", Grouping: &Grouping{Strategy: GroupFlat}},
+				{Name: "scripts", Grouping: &Grouping{Strategy: GroupFlat}},
+				{Name: "docs", Grouping: &Grouping{Strategy: GroupFlat}},
+				{Name: "assets", Grouping: &Grouping{Strategy: GroupFlat}},
+			}},
+			Rules: RuleSet{
+				{Name: "scripts", Extensions: scripts, Destination: "scripts"},
+				{Name: "scripts by content", Content: []string{ContentScript}, Destination: "scripts"},
+				{Name: "source", Extensions: []string{".go", ".py", ".c", ".h", ".cpp", ".hpp", ".rs", ".java", ".kt", ".scala", ".js", ".ts", ".tsx", ".jsx", ".rb", ".php", ".cs", ".swift"}, Destination: "src"},
+				{Name: "project files", Regexp: `(?i)^(readme|license|licence|changelog|contributing|copying)(\.|$)`, Destination: "."},
+				{Name: "documents", Extensions: []string{".md", ".rst", ".txt", ".pdf", ".adoc"}, Destination: "docs"},
+				{Name: "assets", Extensions: images, Destination: "assets"},
+			},
+			Bundles:   BundleSet{},
+			Gitignore: []string{"enforce", "secrets", "logs", "temp", "build", "dependencies", "os", "personal", "go", "python", "node"},
+		},
+		"datascience": {
+			Description: "notebooks, datasets, models and reports",
+			Layout: &Layout{Components: []*Component{
+				{Name: "data", Components: []*Component{{Name: "raw"}, {Name: "processed"}}, Grouping: &Grouping{Strategy: GroupFlat}},
+				{Name: "notebooks", Grouping: &Grouping{Strategy: GroupFlat}},
+				{Name: "src", Grouping: &Grouping{Strategy: GroupFlat}},
+				{Name: "models", Grouping: &Grouping{Strategy: GroupFlat}},
+				{Name: "reports", Components: []*Component{{Name: "figures"}}, Grouping: &Grouping{Strategy: GroupFlat}},
+			}},
+			Rules: RuleSet{
+				{Name: "notebooks", Content: []string{ContentNotebook}, Destination: "notebooks"},
+				{Name: "notebooks by extension", Extensions: []string{".ipynb"}, Destination: "notebooks"},
+				{Name: "source", Extensions: []string{".py", ".r", ".jl", ".sql"}, Destination: "src"},
+				{Name: "models", Extensions: []string{".pkl", ".pt", ".pth", ".onnx", ".joblib", ".h5", ".keras"}, Destination: "models"},
+				{Name: "figures", Extensions: images, Destination: "reports/figures"},
+				{Name: "reports", Extensions: []string{".pdf", ".html", ".md", ".docx", ".pptx"}, Destination: "reports"},
+				{Name: "data", Destination: "data/raw"},
+			},
+			Bundles:   BundleSet{},
+			Gitignore: []string{"enforce", "secrets", "logs", "temp", "os", "personal", "python", "jupyter", "models"},
+		},
+		"archive": {
+			Description: "finished work, grouped by year",
+			Layout: &Layout{Components: []*Component{
+				{Name: "doc", Grouping: &Grouping{Strategy: GroupYear}},
+				{Name: "media", Grouping: &Grouping{Strategy: GroupYear}},
+				{Name: "data", Grouping: &Grouping{Strategy: GroupYear}},
+				{Name: "bin", Grouping: &Grouping{Strategy: GroupFlat}},
+			}},
+			Rules: RuleSet{
+				{Name: "documents by content", Content: documents, Destination: "doc"},
+				{Name: "media by content", Content: []string{ContentPNG, ContentJPEG}, Destination: "media"},
+				{Name: "executables by content", Content: []string{ContentELF, ContentPE}, Destination: "bin"},
+				{Name: "documents", Extensions: []string{".pdf", ".docx", ".doc", ".odt", ".md", ".txt", ".tex", ".html", ".pptx", ".xlsx"}, Destination: "doc"},
+				{Name: "media", Extensions: append([]string{".mp4", ".mkv", ".mov", ".avi", ".mp3", ".wav", ".flac"}, images...), Destination: "media"},
+				{Name: "data", Destination: "data"},
+			},
+			Bundles:   BundleSet{},
+			Gitignore: []string{"enforce", "os"},
+		},
+	}
+}
+
+// contentRules returns the default rules preceded by rules sorting files by
+// their content, with the LS-DYNA results added to the jobs.
+func contentRules() RuleSet {
+	rules := RuleSet{
+		{Name: "documents by content", Content: []string{ContentPDF, ContentDOCX, ContentPPTX, ContentNotebook}, Destination: "doc"},
+		{Name: "media by content", Content: []string{ContentPNG, ContentJPEG}, Destination: "media"},
+		{Name: "executables by content", Content: []string{ContentELF, ContentPE}, Destination: "bin"},
+		{Name: "scripts by content", Content: []string{ContentScript}, Destination: "src"},
+	}
+	for _, rule := range DefaultRules() {
+		if rule.Name == "jobs" {
+			rule.Extensions = append(rule.Extensions, ".d3plot", ".d3hsp", ".d3thdt", ".glstat", ".matsum", ".messag", ".binout")
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// userPresetsDir returns the directory holding the user's presets, one JSON
+// file per preset named after it.
+func userPresetsDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "enforce", "presets"), nil
+}
+
+// ReadPresets reads every preset in dir. A missing directory holds none.
+func ReadPresets(dir string) (map[string]*Preset, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read presets: %w", err)
+	}
+
+	presets := make(map[string]*Preset)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read preset '%s': %w", path, err)
+		}
+		preset := &Preset{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(preset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse preset '%s': %w", path, err)
+		}
+		presets[strings.TrimSuffix(entry.Name(), ".json")] = preset
+	}
+	return presets, nil
+}
+
+// LoadPresets returns the built-in presets and the user's, which replace
+// built-in presets of the same name.
+func LoadPresets() (map[string]*Preset, error) {
+	presets := builtinPresets()
+	dir, err := userPresetsDir()
+	if err != nil {
+		return presets, nil
+	}
+	user, err := ReadPresets(dir)
+	if err != nil {
+		return nil, err
+	}
+	for name, preset := range user {
+		presets[name] = preset
+	}
+	return presets, nil
+}
+
+// PresetNames returns the names of presets in order.
+func PresetNames(presets map[string]*Preset) []string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolvePreset returns the preset called name with the settings it leaves
+// out filled in from the presets it extends and, last, from the defaults.
+func ResolvePreset(presets map[string]*Preset, name string) (*Preset, error) {
+	resolved := &Preset{}
+	seen := make(map[string]bool)
+	for current := name; current != ""; {
+		if seen[current] {
+			return nil, fmt.Errorf("preset '%s' extends itself", current)
+		}
+		seen[current] = true
+
+		preset, ok := presets[current]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset '%s' (want one of %s)", current, strings.Join(PresetNames(presets), ", "))
+		}
+		err := preset.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid preset '%s': %w", current, err)
+		}
+
+		if resolved.Description == "" {
+			resolved.Description = preset.Description
+		}
+		if resolved.Layout == nil {
+			resolved.Layout = preset.Layout
+		}
+		if resolved.Rules == nil {
+			resolved.Rules = preset.Rules
+		}
+		if resolved.Bundles == nil {
+			resolved.Bundles = preset.Bundles
+		}
+		if resolved.Gitignore == nil {
+			resolved.Gitignore = preset.Gitignore
+		}
+		if resolved.GitignorePatterns == nil {
+			resolved.GitignorePatterns = preset.GitignorePatterns
+		}
+		current = preset.Extends
+	}
+
+	if resolved.Layout == nil {
+		resolved.Layout = DefaultLayout()
+	}
+	if resolved.Rules == nil {
+		resolved.Rules = DefaultRules()
+	}
+	if resolved.Bundles == nil {
+		resolved.Bundles = DefaultBundles()
+	}
+	if resolved.Gitignore == nil {
+		resolved.Gitignore = defaultGitignore
+	}
+	return resolved, nil
+}
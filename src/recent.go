@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxRecentProjects is the number of projects remembered.
+const maxRecentProjects = 10
+
+// recentProjectsPath returns the file listing recently enforced projects.
+func recentProjectsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "enforce", "recent"), nil
+}
+
+// RecentProjects returns the projects enforced most recently, newest first,
+// leaving out any that no longer exist.
+func RecentProjects() []string {
+	path, err := recentProjectsPath()
+	if err != nil {
+		return nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var projects []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		project := strings.TrimSpace(scanner.Text())
+		if info, err := os.Stat(project); err == nil && info.IsDir() {
+			projects = append(projects, project)
+		}
+	}
+	return projects
+}
+
+// AddRecentProject moves projectPath to the top of the recent projects.
+func AddRecentProject(projectPath string) error {
+	projectPath, err := filepath.Abs(projectPath)
+	if err != nil {
+		return err
+	}
+	path, err := recentProjectsPath()
+	if err != nil {
+		return err
+	}
+
+	projects := []string{projectPath}
+	for _, project := range RecentProjects() {
+		if project != projectPath && len(projects) < maxRecentProjects {
+			projects = append(projects, project)
+		}
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to save recent projects: %w", err)
+	}
+	err = os.WriteFile(path, []byte(strings.Join(projects, "\n")+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to save recent projects: %w", err)
+	}
+	return nil
+}
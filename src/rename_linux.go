@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// renameNoReplace renames oldPath to newPath, failing if newPath exists.
+func renameNoReplace(oldPath, newPath string) error {
+	err := unix.Renameat2(unix.AT_FDCWD, oldPath, unix.AT_FDCWD, newPath, unix.RENAME_NOREPLACE)
+	if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EINVAL) {
+		// The kernel or file system does not support RENAME_NOREPLACE.
+		return renameNoReplaceFallback(oldPath, newPath)
+	}
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+	}
+	return nil
+}
+
+// isCrossDevice reports whether a rename failed because the paths are on
+// different file systems.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, unix.EXDEV)
+}
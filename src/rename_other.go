@@ -0,0 +1,19 @@
+//go:build !linux && !windows
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// renameNoReplace renames oldPath to newPath, failing if newPath exists.
+func renameNoReplace(oldPath, newPath string) error {
+	return renameNoReplaceFallback(oldPath, newPath)
+}
+
+// isCrossDevice reports whether a rename failed because the paths are on
+// different file systems.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// renameNoReplace renames oldPath to newPath, failing if newPath exists.
+func renameNoReplace(oldPath, newPath string) error {
+	from, err := windows.UTF16PtrFromString(oldPath)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+	}
+	to, err := windows.UTF16PtrFromString(newPath)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+	}
+
+	// Without MOVEFILE_REPLACE_EXISTING the move fails if the target exists.
+	err = windows.MoveFileEx(from, to, 0)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+	}
+	return nil
+}
+
+// isCrossDevice reports whether a rename failed because the paths are on
+// different volumes.
+func isCrossDevice(err error) bool {
+	return errors.Is(err, windows.ERROR_NOT_SAME_DEVICE)
+}
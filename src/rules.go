@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Rule represents a classification rule deciding where the sorter puts a
+// file. Every condition that is set has to match.
+type Rule struct {
+	Name string `json:"name,omitempty"`
+	// Extensions lists file extensions such as ".pdf", compared ignoring case.
+	Extensions []string `json:"extensions,omitempty"`
+	// Glob and Regexp match the file name, PathGlob and PathRegexp the slash
+	// separated path relative to the project directory.
+	Glob       string `json:"glob,omitempty"`
+	PathGlob   string `json:"path_glob,omitempty"`
+	Regexp     string `json:"regexp,omitempty"`
+	PathRegexp string `json:"path_regexp,omitempty"`
+	// MinSize and MaxSize bound the file size, such as 1MiB.
+	MinSize string `json:"min_size,omitempty"`
+	MaxSize string `json:"max_size,omitempty"`
+	// Content lists content types detected from the start of the file, such
+	// as pdf, png, jpeg, zip, docx, xlsx, pptx, elf, pe, script or notebook.
+	Content []string `json:"content,omitempty"`
+	// Destination is the folder the file goes into, relative to the project
+	// directory. {name}, {stem} and {ext} are replaced with the file name,
+	// the name without its extension and the extension without its dot.
+	Destination string `json:"destination"`
+
+	compiled   bool
+	extensions map[string]bool
+	patterns   []rulePattern
+	minSize    int64
+	maxSize    int64
+}
+
+// rulePattern represents a compiled glob or regular expression of a rule.
+type rulePattern struct {
+	// kind is the name of the condition in config files.
+	kind    string
+	pattern string
+	re      *regexp.Regexp
+	// path is set when the pattern matches the path rather than the name.
+	path bool
+}
+
+// maxTextScan is how much of a text file is searched for references to other
+// files or a solver jobname.
+const maxTextScan = 1 << 20
+
+// templatePlaceholder matches a placeholder in a destination template.
+var templatePlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// compile checks the rule and prepares its conditions for matching.
+func (r *Rule) compile() error {
+	if r.compiled {
+		return nil
+	}
+	if r.Destination == "" {
+		return fmt.Errorf("rule '%s' has no destination", r.Name)
+	}
+	for _, placeholder := range templatePlaceholder.FindAllString(r.Destination, -1) {
+		switch placeholder {
+		case "{name}", "{stem}", "{ext}":
+		default:
+			return fmt.Errorf("rule '%s' has an unknown placeholder %s in its destination", r.Name, placeholder)
+		}
+	}
+
+	for _, content := range r.Content {
+		if !isContentType(content) {
+			return fmt.Errorf("rule '%s' has an unknown content type '%s'", r.Name, content)
+		}
+	}
+
+	r.extensions = make(map[string]bool)
+	for _, extension := range r.Extensions {
+		extension = strings.ToLower(extension)
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		r.extensions[extension] = true
+	}
+
+	r.patterns = nil
+	for _, p := range []rulePattern{
+		{kind: "glob", pattern: r.Glob},
+		{kind: "path_glob", pattern: r.PathGlob, path: true},
+		{kind: "regexp", pattern: r.Regexp},
+		{kind: "path_regexp", pattern: r.PathRegexp, path: true},
+	} {
+		if p.pattern == "" {
+			continue
+		}
+		expr := p.pattern
+		if strings.HasSuffix(p.kind, "glob") {
+			expr = "^" + globToRegexp(expr) + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("rule '%s' has an invalid pattern '%s': %w", r.Name, p.pattern, err)
+		}
+		p.re = re
+		r.patterns = append(r.patterns, p)
+	}
+
+	var err error
+	r.minSize, r.maxSize = 0, -1
+	if r.MinSize != "" {
+		r.minSize, err = parseSize(r.MinSize)
+		if err != nil {
+			return fmt.Errorf("rule '%s' has an invalid minimum size: %w", r.Name, err)
+		}
+	}
+	if r.MaxSize != "" {
+		r.maxSize, err = parseSize(r.MaxSize)
+		if err != nil {
+			return fmt.Errorf("rule '%s' has an invalid maximum size: %w", r.Name, err)
+		}
+	}
+	r.compiled = true
+	return nil
+}
+
+// Match reports whether the file meets every condition of the rule.
+func (r *Rule) Match(file *Candidate) bool {
+	return len(r.failures(file, false)) == 0
+}
+
+// conditions returns the number of conditions the rule sets.
+func (r *Rule) conditions() int {
+	n := len(r.patterns)
+	for _, set := range []bool{len(r.Extensions) > 0, r.MinSize != "", r.MaxSize != "", len(r.Content) > 0} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// failures describes the conditions of the rule the file does not meet,
+// stopping at the first unless all is set. The content of the file is only
+// read when every other condition is met or all is set.
+func (r *Rule) failures(file *Candidate, all bool) []string {
+	var failed []string
+	fail := func(format string, args ...interface{}) bool {
+		failed = append(failed, fmt.Sprintf(format, args...))
+		return !all
+	}
+
+	name := filepath.Base(file.Rel)
+	extension := strings.ToLower(filepath.Ext(name))
+	if len(r.extensions) > 0 && !r.extensions[extension] {
+		if fail("extension '%s' is not one of %s", extension, strings.Join(r.Extensions, ", ")) {
+			return failed
+		}
+	}
+	for _, p := range r.patterns {
+		subject := name
+		if p.path {
+			subject = filepath.ToSlash(file.Rel)
+		}
+		if !p.re.MatchString(subject) {
+			if fail("'%s' does not match %s '%s'", subject, p.kind, p.pattern) {
+				return failed
+			}
+		}
+	}
+	if file.Size < r.minSize {
+		if fail("size %s is below min_size %s", formatBytes(file.Size), r.MinSize) {
+			return failed
+		}
+	}
+	if r.maxSize >= 0 && file.Size > r.maxSize {
+		if fail("size %s is above max_size %s", formatBytes(file.Size), r.MaxSize) {
+			return failed
+		}
+	}
+	if len(r.Content) > 0 {
+		content := file.Content()
+		found := false
+		for _, c := range r.Content {
+			found = found || c == content
+		}
+		if !found {
+			if content == "" {
+				content = "unrecognized"
+			}
+			fail("content is %s, not one of %s", content, strings.Join(r.Content, ", "))
+		}
+	}
+	return failed
+}
+
+// Folder returns the destination of the rule for a file named name.
+func (r *Rule) Folder(name string) string {
+	extension := filepath.Ext(name)
+	folder := strings.NewReplacer(
+		"{name}", name,
+		"{stem}", strings.TrimSuffix(name, extension),
+		"{ext}", strings.TrimPrefix(strings.ToLower(extension), "."),
+	).Replace(r.Destination)
+	return filepath.Clean(filepath.FromSlash(folder))
+}
+
+// RuleSet represents classification rules matched in order.
+type RuleSet []*Rule
+
+// DefaultRules returns the rules used when no config declares any, sorting by
+// extension alone.
+func DefaultRules() RuleSet {
+	return RuleSet{
+		{Name: "documents", Extensions: []string{".pdf", ".djvu", ".epub", ".html", ".docx", ".md", ".tex", ".txt", ".doc", ".pptx", ".ipynb"}, Destination: "doc"},
+		{Name: "jobs", Extensions: []string{".rst", ".rth", ".cdb", ".ls-dyna", ".db", ".dbb", ".esav", ".out"}, Destination: "job"},
+		{Name: "media", Extensions: []string{".mkv", ".mp4", ".aac", ".flac", ".wav", ".avi", ".png", ".jpeg", ".mov", ".wmv", ".jpg", ".mp3"}, Destination: "media"},
+		{Name: "source", Extensions: []string{".py", ".go", ".ans", ".inp", ".c", ".m", ".for", ".cpp", ".java", ".scala", ".php", ".sh", ".asm", ".h", ".dat"}, Destination: "src"},
+		{Name: "executables", Extensions: []string{".exe"}, Destination: "bin"},
+		{Name: "data", Destination: "data"},
+	}
+}
+
+// Validate checks every rule.
+func (s RuleSet) Validate() error {
+	for i, rule := range s {
+		err := rule.compile()
+		if err != nil {
+			return fmt.Errorf("invalid rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Classify returns the first rule matching the file and the folder it puts
+// the file in. When no rule matches, the rule is nil and the file stays where
+// it is.
+func (s RuleSet) Classify(file *Candidate) (*Rule, string) {
+	for _, rule := range s {
+		if rule.compile() != nil || !rule.Match(file) {
+			continue
+		}
+		folder := rule.Folder(filepath.Base(file.Rel))
+		if filepath.IsAbs(folder) || isParentRelative(folder) {
+			continue
+		}
+		return rule, folder
+	}
+	return nil, filepath.Dir(file.Rel)
+}
+
+// Candidate represents a file being classified.
+type Candidate struct {
+	// Rel is the path of the file relative to the project directory.
+	Rel     string
+	Size    int64
+	ModTime time.Time
+	open    func() (io.ReadCloser, error)
+	// content is the detected content type, once sniffed, and jobname the
+	// solver jobname, once found.
+	content *string
+	jobname *string
+}
+
+// NewCandidate creates a candidate for the file at path, classified as if it
+// were at rel.
+func NewCandidate(fsys FileSystem, path, rel string, info os.FileInfo) *Candidate {
+	return &Candidate{Rel: rel, Size: info.Size(), ModTime: info.ModTime(), open: func() (io.ReadCloser, error) {
+		return fsys.Open(path)
+	}}
+}
+
+// Content returns the content type detected from the start of the file, or
+// an empty string if it is not recognized or cannot be read.
+func (c *Candidate) Content() string {
+	if c.content == nil {
+		content := ""
+		if file, err := c.open(); err == nil {
+			content, _ = SniffContent(file)
+			file.Close()
+		}
+		c.content = &content
+	}
+	return *c.content
+}
+
+// text returns the start of a text file, or an empty string if it cannot be
+// read.
+func (c *Candidate) text() string {
+	file, err := c.open()
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxTextScan))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCandidate returns a candidate at rel holding content, last modified at
+// modTime.
+func testCandidate(rel, content string, modTime time.Time) *Candidate {
+	return &Candidate{Rel: filepath.FromSlash(rel), Size: int64(len(content)), ModTime: modTime, open: func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(content)), nil
+	}}
+}
+
+func TestRuleSetClassify(t *testing.T) {
+	rules := RuleSet{
+		{Name: "escape", Glob: "evil*", Destination: "../outside"},
+		{Name: "pdf", Extensions: []string{"PDF"}, Destination: "doc"},
+		{Name: "scans", Content: []string{ContentPDF}, Destination: "scans"},
+		{Name: "drafts", Glob: "draft_*", PathGlob: "notes/**", Destination: "drafts"},
+		{Name: "logs", Regexp: `^run_\d+\.log$`, Destination: "logs/{stem}"},
+		{Name: "large", MinSize: "10B", MaxSize: "20B", Destination: "large/{ext}"},
+		{Name: "rest", Destination: "misc"},
+	}
+	if err := rules.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rel     string
+		content string
+		rule    string
+		folder  string
+	}{
+		{"report.pdf", "anything", "pdf", "doc"},
+		{"scan.bin", "%PDF-1.4", "scans", "scans"},
+		{"notes/week1/draft_1.txt", "", "drafts", "drafts"},
+		{"draft_1.txt", "", "rest", "misc"},
+		{"run_42.log", "", "logs", "logs/run_42"},
+		{"run_x.log", "", "rest", "misc"},
+		{"table.CSV", "0123456789abc", "large", "large/csv"},
+		{"table.csv", "0123456789abcdefghijk", "rest", "misc"},
+		// A rule leaving the project is passed over
+		{"evil.txt", "", "rest", "misc"},
+	}
+	for _, tt := range tests {
+		rule, folder := rules.Classify(testCandidate(tt.rel, tt.content, time.Time{}))
+		name := ""
+		if rule != nil {
+			name = rule.Name
+		}
+		if name != tt.rule || folder != filepath.FromSlash(tt.folder) {
+			t.Errorf("Classify(%q) = '%s', '%s', want '%s', '%s'", tt.rel, name, folder, tt.rule, tt.folder)
+		}
+	}
+
+	// Without a matching rule the file stays where it is
+	rule, folder := rules[1:3].Classify(testCandidate("a/b/notes.txt", "", time.Time{}))
+	if rule != nil || folder != filepath.Join("a", "b") {
+		t.Errorf("unmatched file classified as %v, '%s'", rule, folder)
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	for _, rule := range []*Rule{
+		{Name: "no destination"},
+		{Name: "placeholder", Destination: "doc/{year}"},
+		{Name: "content", Content: []string{"mp3"}, Destination: "media"},
+		{Name: "regexp", Regexp: "(", Destination: "src"},
+		{Name: "size", MinSize: "big", Destination: "data"},
+	} {
+		if err := (RuleSet{rule}).Validate(); err == nil {
+			t.Errorf("rule '%s' passed validation", rule.Name)
+		}
+	}
+}
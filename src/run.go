@@ -0,0 +1,473 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The names of the stages of a run.
+const (
+	StageDedupe    = "dedupe"
+	StageFlatten   = "flatten"
+	StagePrune     = "prune"
+	StageRename    = "rename"
+	StageScaffold  = "scaffold"
+	StageSort      = "sort"
+	StageGitignore = "gitignore"
+	StageGitInit   = "gitinit"
+)
+
+// Stage represents a named step of a run.
+type Stage struct {
+	Name    string
+	Summary string
+	// Requires lists the stages that have to run as well when this one does.
+	Requires []string
+}
+
+// Stages lists every stage in the order they run.
+var Stages = []Stage{
+	{Name: StageDedupe, Summary: "find duplicate files and apply the dedupe policy"},
+	{Name: StageFlatten, Summary: "move every file into the project directory"},
+	{Name: StagePrune, Summary: "remove the directories left empty", Requires: []string{StageFlatten}},
+	{Name: StageRename, Summary: "normalize file and project directory names"},
+	{Name: StageScaffold, Summary: "create the project directories"},
+	{Name: StageSort, Summary: "sort files into the project directories", Requires: []string{StageScaffold}},
+	{Name: StageGitignore, Summary: "create a .gitignore"},
+	{Name: StageGitInit, Summary: "initialize a Git repository"},
+}
+
+// AllStages returns the names of every stage in the order they run.
+func AllStages() []string {
+	names := make([]string, len(Stages))
+	for i, stage := range Stages {
+		names[i] = stage.Name
+	}
+	return names
+}
+
+// SelectStages returns the stages in base that are also in only, if it is
+// not empty, and not in skip, in the order they run. Unknown stage names and
+// selections leaving out a stage that a selected one requires are rejected.
+func SelectStages(base, only, skip []string) ([]string, error) {
+	known := make(map[string]Stage)
+	for _, stage := range Stages {
+		known[stage.Name] = stage
+	}
+	for _, name := range append(append(append([]string{}, base...), only...), skip...) {
+		if _, ok := known[name]; !ok {
+			return nil, fmt.Errorf("unknown stage '%s' (want one of %s)", name, strings.Join(AllStages(), ", "))
+		}
+	}
+
+	contains := func(names []string, name string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	var selected []string
+	for _, stage := range Stages {
+		if !contains(base, stage.Name) || (len(only) > 0 && !contains(only, stage.Name)) || contains(skip, stage.Name) {
+			continue
+		}
+		selected = append(selected, stage.Name)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no stages selected")
+	}
+
+	for _, name := range selected {
+		for _, required := range known[name].Requires {
+			if !contains(selected, required) {
+				return nil, fmt.Errorf("stage '%s' requires stage '%s', which is not selected", name, required)
+			}
+		}
+	}
+	return selected, nil
+}
+
+// Options holds the settings of a run.
+type Options struct {
+	Dedupe       DedupePolicy
+	UseGitignore bool
+	Symlinks     SymlinkPolicy
+	Conflict     ConflictPolicy
+	// Layout declares the directories and files the project is scaffolded
+	// with, the default layout if it is nil.
+	Layout *Layout
+	// Rules decide where files are sorted, the default rules if it is nil.
+	Rules RuleSet
+	// Bundles keep related files together, the default bundles if it is nil.
+	Bundles BundleSet
+	// Gitignore lists the fragments of the .gitignore, the default ones if it
+	// is nil, and GitignorePatterns extra patterns added after them.
+	Gitignore         []string
+	GitignorePatterns []string
+}
+
+// layout returns the layout of the run.
+func (o *Options) layout() *Layout {
+	if o.Layout == nil {
+		return DefaultLayout()
+	}
+	return o.Layout
+}
+
+// rules returns the classification rules of the run.
+func (o *Options) rules() RuleSet {
+	if o.Rules == nil {
+		return DefaultRules()
+	}
+	return o.Rules
+}
+
+// bundles returns the bundles of the run.
+func (o *Options) bundles() BundleSet {
+	if o.Bundles == nil {
+		return DefaultBundles()
+	}
+	return o.Bundles
+}
+
+// Run represents the template for enforcing the project structure on a
+// project through a file system.
+type Run struct {
+	ProjectPath string
+	FileSystem  FileSystem
+	Options     *Options
+	Summary     *Summary
+	Log         *slog.Logger
+	// Stages lists the stages to run, all of them if it is empty.
+	Stages []string
+}
+
+// has reports whether the run includes stage.
+func (r *Run) has(stage string) bool {
+	if len(r.Stages) == 0 {
+		return true
+	}
+	for _, s := range r.Stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute runs the selected stages on the project. A failed operation
+// reverses every change made before it and stops the run. Resolving symlinks
+// before the run, rewriting their targets after it and initializing the Git
+// repository are not part of that and cannot be rolled back, so Git comes
+// last and a failure rewriting symlinks is only logged.
+func (r *Run) Execute() error {
+	projectPath := r.ProjectPath
+	r.Log.Debug("starting run", "project", projectPath, "stages", r.stageNames())
+
+	// Never overwrite files; resolve conflicts by policy and list them at the end
+	conflicts := &ConflictResolver{Policy: r.Options.Conflict, Root: projectPath, Summary: r.Summary}
+	tracker := &TrackingFileSystem{FileSystem: r.FileSystem}
+	fsys := FileSystem(tracker)
+	defer func() {
+		r.Summary.Moved = tracker.Moved()
+	}()
+
+	// Leave version control, dependency and ignored directories alone
+	ignore, err := LoadIgnoreMatcher(fsys, projectPath, r.Options.UseGitignore)
+	if err != nil {
+		return err
+	}
+	scope := &Scope{Ignore: ignore, Symlinks: r.Options.Symlinks}
+
+	// Decide what happens to symlinks and special files up front; links
+	// replaced with copies stay that way if the run is rolled back
+	links := &SymlinkHandler{
+		FolderPath: projectPath,
+		FileSystem: tracker,
+		Scope:      scope,
+		Summary:    r.Summary,
+	}
+	err = links.Prepare()
+	if err != nil {
+		return err
+	}
+
+	// Every change to the tree is reversed if a later one fails
+	tx := &Transaction{}
+
+	if r.has(StageDedupe) {
+		// Find duplicate files before anything is moved
+		deduplicator := &Deduplicator{
+			FolderPath: projectPath,
+			FileSystem: fsys,
+			Scope:      scope,
+			Policy:     r.Options.Dedupe,
+			Summary:    r.Summary,
+		}
+		err = tx.Execute(deduplicator)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.has(StageFlatten) {
+		err = r.flatten(fsys, scope, conflicts, tx)
+		if err != nil {
+			return err
+		}
+	}
+	if r.has(StagePrune) {
+		err = r.prune(fsys, scope, tx)
+		if err != nil {
+			return err
+		}
+	}
+	if r.has(StageRename) {
+		err = r.rename(fsys, scope, conflicts, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create a directory structure
+	projectDir := &RecursiveDirectory{Directory: &Directory{path: projectPath}}
+	if r.has(StageScaffold) {
+		r.Options.layout().Scaffold(fsys, projectDir)
+	}
+
+	// Move files to the project directory if the .git directory does not exist
+	gitPath := filepath.Join(projectPath, ".git")
+	_, err = fsys.Stat(gitPath)
+	isRepository := !os.IsNotExist(err)
+	if r.has(StageSort) {
+		if !isRepository {
+			// Extract files to the project directory
+			extractOp := &MoveFileOperation{
+				fsys:       fsys,
+				conflicts:  conflicts,
+				sourcePath: projectPath,
+				destPath:   projectPath,
+			}
+			projectDir.AddOperation(extractOp)
+
+			// Sort files in the project directory
+			sorter := &FileSorter{
+				FolderPath: projectPath,
+				FileSystem: fsys,
+				Scope:      scope,
+				Layout:     r.Options.layout(),
+				Rules:      r.Options.rules(),
+				Bundles:    r.Options.bundles(),
+				Conflicts:  conflicts,
+				Log:        r.Log,
+			}
+			projectDir.AddOperation(sorter)
+		} else {
+			r.Log.Info("Git repository already exists, files will not be sorted", "project", projectPath)
+		}
+	}
+
+	// Execute all file operations
+	err = projectDir.executeOperations(tx)
+	if err != nil {
+		return fmt.Errorf("failed to execute file operations: %w", err)
+	}
+
+	// Rename the project directory last, once nothing else refers to its old
+	// path, and carry on in its new place
+	if r.has(StageRename) && !isRepository {
+		renameOp := &RenameFileOperation{
+			fsys:      fsys,
+			conflicts: conflicts,
+			filePath:  projectPath,
+		}
+		err = tx.Execute(renameOp)
+		if err != nil {
+			return fmt.Errorf("failed to rename project directory: %w", err)
+		}
+		if renameOp.renamed != "" {
+			r.Log.Info("renamed project directory", "source", projectPath, "destination", renameOp.renamed)
+			projectPath = renameOp.renamed
+			gitPath = filepath.Join(projectPath, ".git")
+		}
+	}
+
+	if r.has(StageGitignore) {
+		// Create a .gitignore file
+		textFileFactory := &TextFileFactory{
+			ProjectPath: projectPath,
+			FileSystem:  fsys,
+		}
+		fragments := r.Options.Gitignore
+		if fragments == nil {
+			fragments = defaultGitignore
+		}
+		gitignoreOp, err := textFileFactory.GitignoreOperation(fragments, r.Options.GitignorePatterns)
+		if err != nil {
+			r.report(err)
+		} else {
+			err = tx.Execute(gitignoreOp)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if r.has(StageGitInit) {
+		// Initialize Git repository if it doesn't exist, last since it
+		// cannot be rolled back
+		if _, err := fsys.Stat(gitPath); os.IsNotExist(err) {
+			err = fsys.InitRepository(projectPath)
+			if err != nil {
+				return fmt.Errorf("failed to initialize Git repository: %w", err)
+			}
+			r.Log.Info("initialized Git repository", "project", projectPath)
+		} else {
+			r.Log.Info("Git repository already exists", "project", projectPath)
+		}
+	}
+
+	// Point kept and moved symlinks at the new locations of their targets
+	err = links.Finish()
+	if err != nil {
+		r.report(err)
+	}
+	return nil
+}
+
+// stageNames returns the names of the stages the run includes.
+func (r *Run) stageNames() []string {
+	if len(r.Stages) == 0 {
+		return AllStages()
+	}
+	return r.Stages
+}
+
+// report logs an error that only affects a single file and records it in
+// the summary.
+func (r *Run) report(err error) {
+	r.Summary.Errors = append(r.Summary.Errors, err)
+	r.Log.Error(err.Error())
+}
+
+// required reports whether path is a file the layout requires, which stays
+// where it is.
+func (r *Run) required(path string) bool {
+	rel, err := filepath.Rel(r.ProjectPath, path)
+	return err == nil && r.Options.layout().IsRequiredFile(rel)
+}
+
+// flatten moves every file into the project directory.
+func (r *Run) flatten(fsys FileSystem, scope *Scope, conflicts *ConflictResolver, tx *Transaction) error {
+	projectPath := r.ProjectPath
+
+	// Move files out of the selected directory into the main directory
+	err := walkProject(fsys, projectPath, scope, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() && !r.required(path) && !isJobIndex(fsys, path) {
+			destPath := filepath.Join(projectPath, info.Name())
+			moveOp := &MoveFileOperation{fsys: fsys, conflicts: conflicts, sourcePath: path, destPath: destPath}
+			if err := moveOp.Execute(); err != nil {
+				return tx.Abort(moveOp, err)
+			}
+			tx.Record(moveOp)
+			if moveOp.movedPath != "" && moveOp.movedPath != path {
+				r.Log.Debug("flattened file", "source", path, "destination", moveOp.movedPath)
+			}
+		}
+
+		return nil
+	})
+
+	return r.walkError(err)
+}
+
+// walkError returns err if it stopped the run after rolling it back, and
+// otherwise logs the error of the walk and lets the run carry on.
+func (r *Run) walkError(err error) error {
+	var txErr *TransactionError
+	if errors.As(err, &txErr) {
+		return err
+	}
+	if err != nil {
+		r.report(err)
+	}
+	return nil
+}
+
+// prune removes empty directories, deepest first so that directories only
+// holding empty ones go as well.
+func (r *Run) prune(fsys FileSystem, scope *Scope, tx *Transaction) error {
+	projectPath := r.ProjectPath
+
+	var dirs []string
+	err := walkProject(fsys, projectPath, scope, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path != projectPath {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		r.report(err)
+	}
+
+	// Remove empty directories, children before their parents
+	for i := len(dirs) - 1; i >= 0; i-- {
+		path := dirs[i]
+		isEmpty, err := isDirectoryEmpty(fsys, path)
+		if err != nil {
+			r.report(err)
+			continue
+		}
+
+		if isEmpty {
+			removeOp := &RemoveDirectoryOperation{fsys: fsys, dirPath: path}
+			if err := removeOp.Execute(); err != nil {
+				return tx.Abort(removeOp, err)
+			}
+			tx.Record(removeOp)
+			r.Log.Debug("removed empty directory", "path", path)
+		}
+	}
+	return nil
+}
+
+// rename normalizes the name of every file.
+func (r *Run) rename(fsys FileSystem, scope *Scope, conflicts *ConflictResolver, tx *Transaction) error {
+	projectPath := r.ProjectPath
+
+	// Rename files in the main directory
+	err := walkProject(fsys, projectPath, scope, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			renameOp := &RenameFileOperation{fsys: fsys, conflicts: conflicts, filePath: path}
+			if err := renameOp.Execute(); err != nil {
+				return tx.Abort(renameOp, err)
+			}
+			tx.Record(renameOp)
+			if renameOp.renamed != "" {
+				r.Log.Debug("renamed file", "source", path, "destination", renameOp.renamed)
+			}
+		}
+
+		return nil
+	})
+
+	return r.walkError(err)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTree creates the files in tree, relative to dir.
+func writeTree(t *testing.T, dir string, tree map[string]string) {
+	t.Helper()
+	for rel, content := range tree {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testRun returns a run of stages on the project at projectPath on disk,
+// without Git since it may not be installed.
+func testRun(projectPath string, stages ...string) *Run {
+	if len(stages) == 0 {
+		for _, stage := range AllStages() {
+			if stage != StageGitInit {
+				stages = append(stages, stage)
+			}
+		}
+	}
+	return &Run{
+		ProjectPath: projectPath,
+		FileSystem:  &OSFileSystem{},
+		Options:     &Options{},
+		Summary:     &Summary{},
+		Log:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Stages:      stages,
+	}
+}
+
+func TestRunRenamesProjectDirectoryLast(t *testing.T) {
+	tests := []struct {
+		project string
+		renamed string
+	}{
+		{"My Proj", "my_proj"},
+		{"Thesis", "thesis"},
+		{"Draft - Final", "draft_final"},
+		{"plain", "plain"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.project, func(t *testing.T) {
+			parent := t.TempDir()
+			projectPath := filepath.Join(parent, tt.project)
+			writeTree(t, projectPath, map[string]string{
+				"a/Read Me.txt":     "hello",
+				"b/Some File.pdf":   "%PDF-1.4",
+				"Notes/Summary.txt": "notes",
+			})
+
+			err := testRun(projectPath).Execute()
+			if err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+
+			renamedPath := filepath.Join(parent, tt.renamed)
+			for _, rel := range []string{"doc/read_me/read_me.txt", "doc/some_file/some_file.pdf", "doc/summary/summary.txt", ".gitignore"} {
+				if _, err := os.Lstat(filepath.Join(renamedPath, filepath.FromSlash(rel))); err != nil {
+					t.Errorf("missing %s: %v", rel, err)
+				}
+			}
+			if tt.renamed != tt.project {
+				if _, err := os.Lstat(projectPath); !os.IsNotExist(err) {
+					t.Errorf("project directory '%s' was not renamed", tt.project)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneRemovesNestedEmptyDirectories(t *testing.T) {
+	projectPath := t.TempDir()
+	writeTree(t, projectPath, map[string]string{"a/b/c/file.txt": "x"})
+	for _, dir := range []string{"d/e/f", "a/g/h"} {
+		if err := os.MkdirAll(filepath.Join(projectPath, filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := testRun(projectPath, StageFlatten, StagePrune).Execute()
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	names, err := os.ReadDir(projectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0].Name() != "file.txt" {
+		var got []string
+		for _, name := range names {
+			got = append(got, name.Name())
+		}
+		t.Errorf("project holds %v, want only file.txt", got)
+	}
+}
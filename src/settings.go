@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// setting represents a value that can be set by a config file, an
+// environment variable and a command-line flag.
+type setting struct {
+	// name is the key of the setting in config files.
+	name string
+	flag string
+	env  string
+	// get returns the value set by a config file, if any.
+	get func(c *Config) (string, bool)
+	// set stores the value in a config.
+	set func(c *Config, value string) error
+}
+
+// stringSetting returns a setting stored in a string field of Config.
+func stringSetting(name, flagName string, field func(c *Config) *string) setting {
+	return setting{
+		name: name,
+		flag: flagName,
+		env:  "ENFORCE_" + strings.ToUpper(name),
+		get: func(c *Config) (string, bool) {
+			return *field(c), *field(c) != ""
+		},
+		set: func(c *Config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+// settings lists every layered setting in the order they are shown.
+var settings = []setting{
+	stringSetting("preset", "preset", func(c *Config) *string { return &c.Preset }),
+	stringSetting("dedupe", "dedupe", func(c *Config) *string { return &c.Dedupe }),
+	{
+		name: "use_gitignore",
+		flag: "gitignore",
+		env:  "ENFORCE_USE_GITIGNORE",
+		get: func(c *Config) (string, bool) {
+			if c.UseGitignore == nil {
+				return "", false
+			}
+			return strconv.FormatBool(*c.UseGitignore), true
+		},
+		set: func(c *Config, value string) error {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("'%s' is not true or false", value)
+			}
+			c.UseGitignore = &b
+			return nil
+		},
+	},
+	stringSetting("symlinks", "symlinks", func(c *Config) *string { return &c.Symlinks }),
+	stringSetting("conflict", "conflict", func(c *Config) *string { return &c.Conflict }),
+	{
+		name: "max_files",
+		flag: "max-files",
+		env:  "ENFORCE_MAX_FILES",
+		get: func(c *Config) (string, bool) {
+			if c.MaxFiles == nil {
+				return "", false
+			}
+			return strconv.Itoa(*c.MaxFiles), true
+		},
+		set: func(c *Config, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("'%s' is not a number", value)
+			}
+			c.MaxFiles = &n
+			return nil
+		},
+	},
+	stringSetting("max_size", "max-size", func(c *Config) *string { return &c.MaxSize }),
+	stringSetting("snapshot", "snapshot", func(c *Config) *string { return &c.Snapshot }),
+	stringSetting("snapshot_format", "snapshot-format", func(c *Config) *string { return &c.SnapshotFormat }),
+}
+
+// Settings represents the effective configuration of a project, merged from
+// the built-in defaults, the user's config file, the project's config file,
+// environment variables and command-line flags, in increasing precedence.
+type Settings struct {
+	// Config holds the merged value of every setting.
+	Config  *Config
+	sources map[string]string
+}
+
+// Value returns the effective value of the setting called name.
+func (s *Settings) Value(name string) string {
+	for _, st := range settings {
+		if st.name == name {
+			value, _ := st.get(s.Config)
+			return value
+		}
+	}
+	return ""
+}
+
+// Source describes where the effective value of the setting called name
+// came from.
+func (s *Settings) Source(name string) string {
+	return s.sources[name]
+}
+
+// LoadSettings returns the effective configuration of the project at
+// projectPath, or of no project in particular if it is empty. flags holds
+// the command-line flags; only those set explicitly take part.
+func LoadSettings(projectPath string, flags *flag.FlagSet) (*Settings, error) {
+	s := &Settings{Config: &Config{}, sources: make(map[string]string)}
+	set := func(st setting, value, source string) error {
+		err := st.set(s.Config, value)
+		if err != nil {
+			return fmt.Errorf("invalid %s from %s: %w", st.name, source, err)
+		}
+		s.sources[st.name] = source
+		return nil
+	}
+
+	// Built-in defaults are the defaults of the flags
+	for _, st := range settings {
+		err := set(st, flags.Lookup(st.flag).DefValue, "default")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var files []*Config
+	var fileSources []string
+	if path, err := userConfigPath(); err == nil {
+		file, err := ReadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		fileSources = append(fileSources, fmt.Sprintf("user config '%s'", path))
+	}
+	if projectPath != "" {
+		path := projectConfigPath(projectPath)
+		file, err := ReadConfig(path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+		fileSources = append(fileSources, fmt.Sprintf("project config '%s'", path))
+	}
+
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	// presetLayer is the layer the preset was chosen in: 0 for the default,
+	// then one for each config file, the environment and the flags
+	var presetLayer int
+	for _, st := range settings {
+		layer := 0
+		for i, file := range files {
+			if value, ok := st.get(file); ok {
+				err := set(st, value, fileSources[i])
+				if err != nil {
+					return nil, err
+				}
+				layer = i + 1
+			}
+		}
+		if value, ok := os.LookupEnv(st.env); ok {
+			err := set(st, value, fmt.Sprintf("environment %s", st.env))
+			if err != nil {
+				return nil, err
+			}
+			layer = len(files) + 1
+		}
+		if explicit[st.flag] {
+			err := set(st, flags.Lookup(st.flag).Value.String(), fmt.Sprintf("flag -%s", st.flag))
+			if err != nil {
+				return nil, err
+			}
+			layer = len(files) + 2
+		}
+		if st.name == "preset" {
+			presetLayer = layer
+		}
+	}
+
+	// The preset fills in the layout, rules and .gitignore, which config
+	// files can replace in turn unless the preset was chosen after them
+	presets, err := LoadPresets()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		for name, p := range file.Presets {
+			presets[name] = p
+		}
+	}
+	if s.Config.Preset == "" {
+		s.Config.Preset = DefaultPreset
+	}
+	preset, err := ResolvePreset(presets, s.Config.Preset)
+	if err != nil {
+		return nil, err
+	}
+	source := fmt.Sprintf("preset '%s'", s.Config.Preset)
+	s.Config.Layout, s.sources["layout"] = preset.Layout, source
+	s.Config.Rules, s.sources["rules"] = preset.Rules, source
+	s.Config.Bundles, s.sources["bundles"] = preset.Bundles, source
+	s.Config.Gitignore, s.sources["gitignore"] = preset.Gitignore, source
+	s.Config.GitignorePatterns, s.sources["gitignore_patterns"] = preset.GitignorePatterns, source
+	for i, file := range files {
+		if i+1 < presetLayer {
+			continue
+		}
+		if file.Layout != nil {
+			s.Config.Layout, s.sources["layout"] = file.Layout, fileSources[i]
+		}
+		if file.Rules != nil {
+			s.Config.Rules, s.sources["rules"] = file.Rules, fileSources[i]
+		}
+		if file.Bundles != nil {
+			s.Config.Bundles, s.sources["bundles"] = file.Bundles, fileSources[i]
+		}
+		if file.Gitignore != nil {
+			s.Config.Gitignore, s.sources["gitignore"] = file.Gitignore, fileSources[i]
+		}
+		if file.GitignorePatterns != nil {
+			s.Config.GitignorePatterns, s.sources["gitignore_patterns"] = file.GitignorePatterns, fileSources[i]
+		}
+	}
+	return s, nil
+}
+
+// Options parses the settings of a run.
+func (s *Settings) Options() (*Options, error) {
+	conflict, err := ParseConflictPolicy(s.Value("conflict"))
+	if err != nil {
+		return nil, s.invalid("conflict", err)
+	}
+	dedupe, err := ParseDedupePolicy(s.Value("dedupe"))
+	if err != nil {
+		return nil, s.invalid("dedupe", err)
+	}
+	symlinks, err := ParseSymlinkPolicy(s.Value("symlinks"))
+	if err != nil {
+		return nil, s.invalid("symlinks", err)
+	}
+	return &Options{
+		Dedupe:            dedupe,
+		UseGitignore:      *s.Config.UseGitignore,
+		Symlinks:          symlinks,
+		Conflict:          conflict,
+		Layout:            s.Config.Layout,
+		Rules:             s.Config.Rules,
+		Bundles:           s.Config.Bundles,
+		Gitignore:         s.Config.Gitignore,
+		GitignorePatterns: s.Config.GitignorePatterns,
+	}, nil
+}
+
+// invalid adds where the setting called name came from to err.
+func (s *Settings) invalid(name string, err error) error {
+	return fmt.Errorf("%w (from %s)", err, s.Source(name))
+}
+
+// SettingObject is the JSON form of the effective value of a setting.
+type SettingObject struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// Entries returns the effective value of every setting and where it came
+// from, summarizing the layout and rules.
+func (s *Settings) Entries() []SettingObject {
+	var entries []SettingObject
+	for _, st := range settings {
+		entries = append(entries, SettingObject{Name: st.name, Value: s.Value(st.name), Source: s.Source(st.name)})
+	}
+
+	var components []string
+	for _, component := range s.Config.Layout.Components {
+		components = append(components, component.Name)
+	}
+	return append(entries,
+		SettingObject{Name: "layout", Value: strings.Join(components, ", "), Source: s.Source("layout")},
+		SettingObject{Name: "rules", Value: fmt.Sprintf("%d rules", len(s.Config.Rules)), Source: s.Source("rules")},
+		SettingObject{Name: "bundles", Value: fmt.Sprintf("%d bundles", len(s.Config.Bundles)), Source: s.Source("bundles")},
+		SettingObject{Name: "gitignore", Value: strings.Join(s.Config.Gitignore, ", "), Source: s.Source("gitignore")},
+		SettingObject{Name: "gitignore_patterns", Value: strings.Join(s.Config.GitignorePatterns, ", "), Source: s.Source("gitignore_patterns")},
+	)
+}
+
+// Print writes the effective value of every setting and where it came from
+// to w, followed by the merged config in the format of a config file.
+func (s *Settings) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Setting\tValue\tSource")
+	for _, entry := range s.Entries() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", entry.Name, entry.Value, entry.Source)
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s.Config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to format config: %w", err)
+	}
+	fmt.Fprintf(w, "\nMerged config:\n%s\n", data)
+	return nil
+}
+
+// SettingsObject is the JSON form of an effective configuration.
+type SettingsObject struct {
+	Type     string          `json:"type"`
+	Project  string          `json:"project,omitempty"`
+	Settings []SettingObject `json:"settings"`
+	Config   *Config         `json:"config"`
+}
+
+// Object returns the JSON form of the effective configuration of project.
+func (s *Settings) Object(project string) SettingsObject {
+	return SettingsObject{Type: "config", Project: project, Settings: s.Entries(), Config: s.Config}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadSettingsPresetPrecedence(t *testing.T) {
+	projectConfig := filepath.Join(enforceDirName, configFileName)
+	tests := []struct {
+		name   string
+		config string
+		env    string
+		args   []string
+		source string
+	}{
+		{"config rules replace the default preset", `{"rules": [{"destination": "misc"}]}`, "", nil, "project config"},
+		{"config rules replace a preset from the same file", `{"preset": "paper", "rules": [{"destination": "misc"}]}`, "", nil, "project config"},
+		{"flag preset replaces config rules", `{"rules": [{"destination": "misc"}]}`, "", []string{"-preset", "paper"}, "preset 'paper'"},
+		{"environment preset replaces config rules", `{"rules": [{"destination": "misc"}]}`, "software", nil, "preset 'software'"},
+		{"flag preset replaces a config preset", `{"preset": "software"}`, "", []string{"-preset", "paper"}, "preset 'paper'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Keep the user's own config and presets out of the way
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			t.Setenv("XDG_CONFIG_HOME", home)
+			t.Setenv("AppData", home)
+			t.Setenv("ENFORCE_PRESET", tt.env)
+			if tt.env == "" {
+				os.Unsetenv("ENFORCE_PRESET")
+			}
+
+			projectPath := t.TempDir()
+			writeTree(t, projectPath, map[string]string{filepath.ToSlash(projectConfig): tt.config})
+			c := NewCLI(io.Discard)
+			err := c.flags.Parse(tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s, err := LoadSettings(projectPath, c.flags)
+			if err != nil {
+				t.Fatalf("failed to load settings: %v", err)
+			}
+			source := s.Source("rules")
+			if !strings.HasPrefix(source, tt.source) {
+				t.Errorf("rules come from %s, want %s", source, tt.source)
+			}
+		})
+	}
+}
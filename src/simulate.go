@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// PlanStep represents a single operation recorded by a simulated run.
+type PlanStep struct {
+	Action string
+	Path   string
+	Dest   string
+	Dir    bool
+}
+
+// simNode represents a file or directory in the simulated tree.
+type simNode struct {
+	name     string
+	mode     os.FileMode
+	size     int64
+	modTime  time.Time
+	children map[string]*simNode
+
+	// source is the on-disk file the node was loaded from, data the contents
+	// of a file written during the simulation.
+	source string
+	data   []byte
+	target string
+}
+
+func (n *simNode) Name() string       { return n.name }
+func (n *simNode) Size() int64        { return n.size }
+func (n *simNode) Mode() os.FileMode  { return n.mode }
+func (n *simNode) ModTime() time.Time { return n.modTime }
+func (n *simNode) IsDir() bool        { return n.mode.IsDir() }
+func (n *simNode) Sys() interface{}   { return nil }
+
+// SimulatedFileSystem is a FileSystem that applies operations to an in-memory
+// copy of a project tree and records them instead of touching the disk.
+type SimulatedFileSystem struct {
+	origin string
+	root   string
+	tree   *simNode
+	steps  []PlanStep
+}
+
+// NewSimulatedFileSystem creates a simulated view of the tree rooted at root.
+func NewSimulatedFileSystem(root string) (*SimulatedFileSystem, error) {
+	root = filepath.Clean(root)
+	s := &SimulatedFileSystem{origin: root, root: root}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		n := &simNode{name: info.Name(), mode: info.Mode(), size: info.Size(), modTime: info.ModTime(), source: path}
+		if info.Mode()&os.ModeSymlink != 0 {
+			n.target, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+		if info.IsDir() {
+			n.children = make(map[string]*simNode)
+		}
+		if path == root {
+			s.tree = n
+			return nil
+		}
+
+		parent := s.find(filepath.Dir(path))
+		parent.children[n.name] = n
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read project tree '%s': %w", root, err)
+	}
+
+	return s, nil
+}
+
+// split returns the components of path relative to the simulated root, and
+// whether path lies inside the root at all.
+func (s *SimulatedFileSystem) split(path string) ([]string, bool) {
+	rel, err := filepath.Rel(s.root, filepath.Clean(path))
+	if err != nil || isParentRelative(rel) {
+		return nil, false
+	}
+	if rel == "." {
+		return nil, true
+	}
+	return strings.Split(rel, string(filepath.Separator)), true
+}
+
+// isParentRelative reports whether a relative path climbs out of its base.
+func isParentRelative(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (s *SimulatedFileSystem) find(path string) *simNode {
+	parts, ok := s.split(path)
+	if !ok {
+		return nil
+	}
+
+	n := s.tree
+	for _, part := range parts {
+		if n.children == nil {
+			return nil
+		}
+		n = n.children[part]
+		if n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+func (s *SimulatedFileSystem) record(action, path, dest string) {
+	s.steps = append(s.steps, PlanStep{Action: action, Path: path, Dest: dest})
+}
+
+// recordNode records an operation on the node n.
+func (s *SimulatedFileSystem) recordNode(action, path, dest string, n *simNode) {
+	s.steps = append(s.steps, PlanStep{Action: action, Path: path, Dest: dest, Dir: n.IsDir()})
+}
+
+// Stat returns the simulated file info for path.
+func (s *SimulatedFileSystem) Stat(path string) (os.FileInfo, error) {
+	if _, ok := s.split(path); !ok {
+		return os.Stat(path)
+	}
+	n := s.find(path)
+	if n == nil {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+	}
+	return n, nil
+}
+
+// Lstat returns the simulated file info for path.
+func (s *SimulatedFileSystem) Lstat(path string) (os.FileInfo, error) {
+	if _, ok := s.split(path); !ok {
+		return os.Lstat(path)
+	}
+	n := s.find(path)
+	if n == nil {
+		return nil, &os.PathError{Op: "lstat", Path: path, Err: os.ErrNotExist}
+	}
+	return n, nil
+}
+
+// ReadDirNames returns the sorted names of the entries in a simulated directory.
+func (s *SimulatedFileSystem) ReadDirNames(path string) ([]string, error) {
+	n := s.find(path)
+	if n == nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	if !n.IsDir() {
+		return nil, &os.PathError{Op: "readdirent", Path: path, Err: syscall.ENOTDIR}
+	}
+
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Open opens a simulated file for reading. Files that existed when the
+// simulation started are read from disk.
+func (s *SimulatedFileSystem) Open(path string) (io.ReadCloser, error) {
+	if _, ok := s.split(path); !ok {
+		return os.Open(path)
+	}
+	n := s.find(path)
+	if n == nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	if n.IsDir() || n.source == "" {
+		return io.NopCloser(bytes.NewReader(n.data)), nil
+	}
+	return os.Open(n.source)
+}
+
+// Readlink returns the target of a simulated symlink.
+func (s *SimulatedFileSystem) Readlink(path string) (string, error) {
+	if _, ok := s.split(path); !ok {
+		return os.Readlink(path)
+	}
+	n := s.find(path)
+	if n == nil || n.mode&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: path, Err: syscall.EINVAL}
+	}
+	return n.target, nil
+}
+
+// Walk walks the simulated tree rooted at root with the same visiting order
+// and error semantics as filepath.Walk.
+func (s *SimulatedFileSystem) Walk(root string, fn filepath.WalkFunc) error {
+	info, err := s.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = s.walk(root, info, fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (s *SimulatedFileSystem) walk(path string, info os.FileInfo, fn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	names, err := s.ReadDirNames(path)
+	err1 := fn(path, info, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+
+	for _, name := range names {
+		filename := filepath.Join(path, name)
+		fileInfo, err := s.Lstat(filename)
+		if err != nil {
+			if err := fn(filename, fileInfo, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+			continue
+		}
+		err = s.walk(filename, fileInfo, fn)
+		if err != nil {
+			if !fileInfo.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Rename moves a node within the simulated tree. Like OSFileSystem.Rename it
+// never replaces an existing path.
+func (s *SimulatedFileSystem) Rename(oldPath, newPath string) error {
+	n := s.find(oldPath)
+	if n == nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrNotExist}
+	}
+	if filepath.Clean(oldPath) == filepath.Clean(newPath) {
+		return nil
+	}
+	if n == s.tree {
+		// Renaming the project directory itself moves the whole simulation.
+		// The directory it was read from is only in the simulation, so it is
+		// free once the simulation has moved away from it
+		if s.existsOutside(newPath) {
+			return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrExist}
+		}
+		s.root = filepath.Clean(newPath)
+		n.name = filepath.Base(s.root)
+		s.recordNode("move", oldPath, newPath, n)
+		return nil
+	}
+
+	parent := s.find(filepath.Dir(newPath))
+	if parent == nil || !parent.IsDir() {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrNotExist}
+	}
+	if rel, err := filepath.Rel(oldPath, newPath); err == nil && !isParentRelative(rel) {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: syscall.EINVAL}
+	}
+	if parent.children[filepath.Base(newPath)] != nil {
+		return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: os.ErrExist}
+	}
+
+	delete(s.find(filepath.Dir(oldPath)).children, n.name)
+	n.name = filepath.Base(newPath)
+	parent.children[n.name] = n
+	s.recordNode("move", oldPath, newPath, n)
+	return nil
+}
+
+// existsOutside reports whether path exists next to the simulated tree. The
+// directory the simulation was read from never does, whatever is on disk.
+func (s *SimulatedFileSystem) existsOutside(path string) bool {
+	if filepath.Clean(path) == s.origin {
+		return false
+	}
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// MkdirAll creates any missing directories along path in the simulated tree.
+func (s *SimulatedFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	parts, ok := s.split(path)
+	if !ok {
+		return &os.PathError{Op: "mkdir", Path: path, Err: os.ErrPermission}
+	}
+
+	n := s.tree
+	current := s.root
+	for _, part := range parts {
+		current = filepath.Join(current, part)
+		child := n.children[part]
+		if child == nil {
+			child = &simNode{name: part, mode: os.ModeDir | perm, modTime: time.Now(), children: make(map[string]*simNode)}
+			n.children[part] = child
+			s.record("mkdir", current, "")
+		} else if !child.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: current, Err: syscall.ENOTDIR}
+		}
+		n = child
+	}
+	return nil
+}
+
+// Remove removes a file or empty directory from the simulated tree.
+func (s *SimulatedFileSystem) Remove(path string) error {
+	n := s.find(path)
+	if n == nil {
+		return &os.PathError{Op: "remove", Path: path, Err: os.ErrNotExist}
+	}
+	if len(n.children) > 0 {
+		return &os.PathError{Op: "remove", Path: path, Err: syscall.ENOTEMPTY}
+	}
+	if n != s.tree {
+		delete(s.find(filepath.Dir(path)).children, n.name)
+	}
+	s.recordNode("remove", path, "", n)
+	return nil
+}
+
+// ReplaceWithLink replaces the node at newPath with one sharing the
+// contents of oldPath.
+func (s *SimulatedFileSystem) ReplaceWithLink(oldPath, newPath string) error {
+	n := s.find(oldPath)
+	if n == nil || n.IsDir() {
+		return &os.LinkError{Op: "link", Old: oldPath, New: newPath, Err: os.ErrNotExist}
+	}
+	parent := s.find(filepath.Dir(newPath))
+	if parent == nil || !parent.IsDir() {
+		return &os.LinkError{Op: "link", Old: oldPath, New: newPath, Err: os.ErrNotExist}
+	}
+
+	link := *n
+	link.name = filepath.Base(newPath)
+	parent.children[link.name] = &link
+	s.record("link", oldPath, newPath)
+	return nil
+}
+
+// Symlink adds a symlink to the simulated tree.
+func (s *SimulatedFileSystem) Symlink(target, path string) error {
+	parent := s.find(filepath.Dir(path))
+	if parent == nil || !parent.IsDir() {
+		return &os.LinkError{Op: "symlink", Old: target, New: path, Err: os.ErrNotExist}
+	}
+	name := filepath.Base(path)
+	if parent.children[name] != nil {
+		return &os.LinkError{Op: "symlink", Old: target, New: path, Err: os.ErrExist}
+	}
+
+	parent.children[name] = &simNode{name: name, mode: os.ModeSymlink | 0777, size: int64(len(target)), modTime: time.Now(), target: target}
+	s.record("symlink", path, target)
+	return nil
+}
+
+// WriteFile creates or replaces a file in the simulated tree. Files outside
+// the simulated root are only recorded.
+func (s *SimulatedFileSystem) WriteFile(path string, data []byte, perm os.FileMode) error {
+	if _, ok := s.split(path); !ok {
+		s.record("write", path, "")
+		return nil
+	}
+
+	parent := s.find(filepath.Dir(path))
+	if parent == nil || !parent.IsDir() {
+		return &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+
+	name := filepath.Base(path)
+	parent.children[name] = &simNode{name: name, mode: perm, size: int64(len(data)), modTime: time.Now(), data: data}
+	s.record("write", path, "")
+	return nil
+}
+
+// InitRepository records a Git initialization and adds its .git directory to
+// the simulated tree.
+func (s *SimulatedFileSystem) InitRepository(path string) error {
+	parent := s.find(path)
+	if parent == nil || !parent.IsDir() {
+		return &os.PathError{Op: "git init", Path: path, Err: os.ErrNotExist}
+	}
+
+	if parent.children[".git"] == nil {
+		parent.children[".git"] = &simNode{name: ".git", mode: os.ModeDir | 0755, modTime: time.Now(), children: make(map[string]*simNode)}
+	}
+	s.record("git", path, "")
+	return nil
+}
+
+// Steps returns the operations recorded so far, in order.
+func (s *SimulatedFileSystem) Steps() []PlanStep {
+	return s.steps
+}
+
+// display shortens a path to be relative to the original root where possible.
+func (s *SimulatedFileSystem) display(path string) string {
+	rel, err := filepath.Rel(s.origin, path)
+	if err != nil || isParentRelative(rel) {
+		return path
+	}
+	return rel
+}
+
+// PrintPlan writes the recorded operations to w.
+func (s *SimulatedFileSystem) PrintPlan(w io.Writer) {
+	fmt.Fprintf(w, "Planned operations for '%s' (%d, nothing was changed):\n", s.origin, len(s.steps))
+	for i, step := range s.steps {
+		switch step.Action {
+		case "move", "link":
+			fmt.Fprintf(w, "%5d. %-7s %s -> %s\n", i+1, step.Action, s.display(step.Path), s.display(step.Dest))
+		case "symlink":
+			fmt.Fprintf(w, "%5d. %-7s %s -> %s\n", i+1, step.Action, s.display(step.Path), step.Dest)
+		case "git":
+			fmt.Fprintf(w, "%5d. %-7s init %s\n", i+1, step.Action, s.display(step.Path))
+		default:
+			fmt.Fprintf(w, "%5d. %-7s %s\n", i+1, step.Action, s.display(step.Path))
+		}
+	}
+}
+
+// Impact summarizes how a simulated run changes a project.
+type Impact struct {
+	FilesMoved   int
+	NamesChanged int
+	DirsRemoved  int
+}
+
+// Impact works out how many files end up in a different directory or under a
+// different name, and how many directories are removed. Renaming the project
+// directory itself does not count as moving the files inside it.
+func (s *SimulatedFileSystem) Impact() Impact {
+	// original maps the current path of every moved file, relative to the
+	// project directory, to where it started.
+	original := make(map[string]string)
+	root := s.origin
+	impact := Impact{}
+	for _, step := range s.steps {
+		switch {
+		case step.Action == "move" && step.Dir && filepath.Clean(step.Path) == root:
+			root = filepath.Clean(step.Dest)
+
+		case step.Action == "move":
+			from, err1 := filepath.Rel(root, step.Path)
+			to, err2 := filepath.Rel(root, step.Dest)
+			if err1 != nil || err2 != nil || isParentRelative(from) || isParentRelative(to) {
+				continue
+			}
+			if !step.Dir {
+				start, ok := original[from]
+				if !ok {
+					start = from
+				}
+				delete(original, from)
+				original[to] = start
+				continue
+			}
+			prefix := from + string(filepath.Separator)
+			for current, start := range original {
+				if strings.HasPrefix(current, prefix) {
+					delete(original, current)
+					original[filepath.Join(to, current[len(prefix):])] = start
+				}
+			}
+
+		case step.Action == "remove" && step.Dir:
+			impact.DirsRemoved++
+		}
+	}
+
+	for current, start := range original {
+		if filepath.Dir(current) != filepath.Dir(start) {
+			impact.FilesMoved++
+		}
+		if filepath.Base(current) != filepath.Base(start) {
+			impact.NamesChanged++
+		}
+	}
+	return impact
+}
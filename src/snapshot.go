@@ -0,0 +1,490 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const manifestEntryName = ".enforce-manifest.json"
+
+// SnapshotFormat is the archive format of a snapshot.
+type SnapshotFormat string
+
+const (
+	// SnapshotTarGz writes a gzip compressed tar archive.
+	SnapshotTarGz SnapshotFormat = "tar.gz"
+	// SnapshotZip writes a zip archive.
+	SnapshotZip SnapshotFormat = "zip"
+)
+
+// ParseSnapshotFormat parses the name of a snapshot format.
+func ParseSnapshotFormat(name string) (SnapshotFormat, error) {
+	switch format := SnapshotFormat(name); format {
+	case SnapshotTarGz, SnapshotZip:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown snapshot format '%s' (want tar.gz or zip)", name)
+}
+
+// ManifestEntry describes one path stored in a snapshot.
+type ManifestEntry struct {
+	Path    string      `json:"path"`
+	Type    string      `json:"type"`
+	Size    int64       `json:"size,omitempty"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modTime"`
+	SHA256  string      `json:"sha256,omitempty"`
+	Target  string      `json:"target,omitempty"`
+}
+
+// SnapshotManifest lists every path stored in a snapshot.
+type SnapshotManifest struct {
+	Root    string          `json:"root"`
+	Created time.Time       `json:"created"`
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// Snapshot represents the template for archiving a project before a run.
+type Snapshot struct {
+	FolderPath string
+	Dir        string
+	Format     SnapshotFormat
+}
+
+// snapshotWriter is the part of an archive writer a snapshot needs.
+type snapshotWriter interface {
+	add(entry ManifestEntry, r io.Reader) error
+	Close() error
+}
+
+// Create writes the snapshot archive and its manifest and returns the path of
+// the archive.
+func (s *Snapshot) Create() (string, error) {
+	root, err := filepath.Abs(s.FolderPath)
+	if err != nil {
+		return "", err
+	}
+	dir, err := filepath.Abs(s.Dir)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, dir); err == nil && !isParentRelative(rel) {
+		return "", fmt.Errorf("snapshot directory '%s' must be outside the project", dir)
+	}
+
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory '%s': %w", dir, err)
+	}
+
+	name := fmt.Sprintf("%s-%s.%s", filepath.Base(root), time.Now().Format("20060102-150405"), s.Format)
+	archivePath := filepath.Join(dir, name)
+	file, err := os.OpenFile(archivePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer file.Close()
+
+	var w snapshotWriter
+	if s.Format == SnapshotZip {
+		w = &zipSnapshotWriter{zip.NewWriter(file)}
+	} else {
+		gz := gzip.NewWriter(file)
+		w = &tarSnapshotWriter{gz: gz, tw: tar.NewWriter(gz)}
+	}
+
+	manifest, err := writeSnapshotEntries(w, root)
+	if err != nil {
+		w.Close()
+		os.Remove(archivePath)
+		return "", fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	err = w.add(ManifestEntry{Path: manifestEntryName, Type: "file", Size: int64(len(data)), Mode: 0644, ModTime: manifest.Created}, strings.NewReader(string(data)))
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		os.Remove(archivePath)
+		return "", fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	err = os.WriteFile(archivePath+".manifest.json", data, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to write snapshot manifest: %w", err)
+	}
+	return archivePath, nil
+}
+
+// writeSnapshotEntries adds every path under root to w, hashing files as
+// they are written.
+func writeSnapshotEntries(w snapshotWriter, root string) (*SnapshotManifest, error) {
+	manifest := &SnapshotManifest{Root: root, Created: time.Now()}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		entry := ManifestEntry{Path: filepath.ToSlash(rel), Mode: info.Mode(), ModTime: info.ModTime()}
+
+		switch {
+		case info.IsDir():
+			entry.Type = "dir"
+			err = w.add(entry, nil)
+		case info.Mode()&os.ModeSymlink != 0:
+			entry.Type = "symlink"
+			entry.Target, err = os.Readlink(p)
+			if err == nil {
+				err = w.add(entry, nil)
+			}
+		case info.Mode().IsRegular():
+			entry.Type = "file"
+			entry.Size = info.Size()
+			entry.SHA256, err = addSnapshotFile(w, entry, p)
+		default:
+			// Sockets, pipes and devices cannot be archived.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		manifest.Entries = append(manifest.Entries, entry)
+		return nil
+	})
+	return manifest, err
+}
+
+func addSnapshotFile(w snapshotWriter, entry ManifestEntry, p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	err = w.add(entry, io.TeeReader(f, h))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+type tarSnapshotWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (t *tarSnapshotWriter) add(entry ManifestEntry, r io.Reader) error {
+	hdr := &tar.Header{Name: entry.Path, Mode: int64(entry.Mode.Perm()), ModTime: entry.ModTime, Format: tar.FormatPAX}
+	switch entry.Type {
+	case "dir":
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case "symlink":
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = entry.Target
+	default:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = entry.Size
+	}
+
+	err := t.tw.WriteHeader(hdr)
+	if err != nil || r == nil {
+		return err
+	}
+	_, err = io.Copy(t.tw, r)
+	return err
+}
+
+func (t *tarSnapshotWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
+
+type zipSnapshotWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipSnapshotWriter) add(entry ManifestEntry, r io.Reader) error {
+	hdr := &zip.FileHeader{Name: entry.Path, Method: zip.Deflate, Modified: entry.ModTime}
+	switch entry.Type {
+	case "dir":
+		hdr.Name += "/"
+		hdr.SetMode(os.ModeDir | entry.Mode.Perm())
+	case "symlink":
+		hdr.SetMode(os.ModeSymlink | entry.Mode.Perm())
+		r = strings.NewReader(entry.Target)
+	default:
+		hdr.SetMode(entry.Mode.Perm())
+	}
+
+	fw, err := z.zw.CreateHeader(hdr)
+	if err != nil || r == nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+	return err
+}
+
+func (z *zipSnapshotWriter) Close() error {
+	return z.zw.Close()
+}
+
+// snapshotFile is one entry read back from a snapshot archive.
+type snapshotFile struct {
+	name string
+	open func() (io.ReadCloser, error)
+}
+
+// readSnapshot lists the entries of a snapshot archive, calling fn for each.
+func readSnapshot(archivePath string, fn func(f snapshotFile) error) error {
+	if strings.HasSuffix(archivePath, "."+string(SnapshotZip)) {
+		zr, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if err := fn(snapshotFile{name: strings.TrimSuffix(f.Name, "/"), open: f.Open}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		open := func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+		if err := fn(snapshotFile{name: strings.TrimSuffix(hdr.Name, "/"), open: open}); err != nil {
+			return err
+		}
+	}
+}
+
+// readSnapshotManifest reads the manifest stored in a snapshot archive.
+func readSnapshotManifest(archivePath string) (*SnapshotManifest, error) {
+	var manifest *SnapshotManifest
+	err := readSnapshot(archivePath, func(f snapshotFile) error {
+		if f.name != manifestEntryName {
+			return nil
+		}
+		r, err := f.open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		manifest = &SnapshotManifest{}
+		return json.NewDecoder(r).Decode(manifest)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("'%s' has no manifest", archivePath)
+	}
+	return manifest, nil
+}
+
+// RestoreSnapshot rebuilds the tree stored in a snapshot at target, or at the
+// original location if target is empty. The tree is extracted and verified
+// next to target first; whatever was at target is kept and its new location
+// returned.
+func RestoreSnapshot(archivePath, target string) (string, string, error) {
+	manifest, err := readSnapshotManifest(archivePath)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if target == "" {
+		target = manifest.Root
+	}
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return "", "", err
+	}
+
+	stamp := time.Now().Format("20060102-150405")
+	staging := fmt.Sprintf("%s.restore-%s", target, stamp)
+	err = extractSnapshot(archivePath, manifest, staging)
+	if err != nil {
+		os.RemoveAll(staging)
+		return "", "", fmt.Errorf("failed to restore snapshot: %w", err)
+	}
+
+	previous := ""
+	if _, err := os.Lstat(target); err == nil {
+		previous = fmt.Sprintf("%s.before-restore-%s", target, stamp)
+		err = os.Rename(target, previous)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to move '%s' aside: %w", target, err)
+		}
+	}
+	err = os.Rename(staging, target)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to move restored tree into place: %w", err)
+	}
+	return target, previous, nil
+}
+
+// extractSnapshot extracts a snapshot into dir and verifies it against the
+// manifest.
+func extractSnapshot(archivePath string, manifest *SnapshotManifest, dir string) error {
+	entries := make(map[string]ManifestEntry)
+	for _, entry := range manifest.Entries {
+		entries[entry.Path] = entry
+	}
+
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	// Symlinks are created after every other entry, so that no entry can
+	// be written through one to a place outside dir
+	restored := make(map[string]bool)
+	var links []ManifestEntry
+	err = readSnapshot(archivePath, func(f snapshotFile) error {
+		entry, ok := entries[f.name]
+		if !ok {
+			return nil
+		}
+		clean := path.Clean(entry.Path)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return fmt.Errorf("refusing to extract '%s' outside the target", entry.Path)
+		}
+		dest := filepath.Join(dir, filepath.FromSlash(clean))
+
+		switch entry.Type {
+		case "dir":
+			err = os.MkdirAll(dest, os.ModePerm)
+		case "symlink":
+			links = append(links, entry)
+			return nil
+		default:
+			err = extractSnapshotFile(f, entry, dest)
+		}
+		if err != nil {
+			return err
+		}
+		restored[entry.Path] = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	linked := make(map[string]bool)
+	for _, entry := range links {
+		linked[path.Clean(entry.Path)] = true
+	}
+	for p := range entries {
+		for parent := path.Dir(path.Clean(p)); parent != "."; parent = path.Dir(parent) {
+			if linked[parent] {
+				return fmt.Errorf("refusing to extract '%s' inside the symlink '%s'", p, parent)
+			}
+		}
+	}
+	for _, entry := range links {
+		dest := filepath.Join(dir, filepath.FromSlash(path.Clean(entry.Path)))
+		err = os.Symlink(entry.Target, dest)
+		if err != nil {
+			return err
+		}
+		restored[entry.Path] = true
+	}
+
+	for _, entry := range manifest.Entries {
+		if !restored[entry.Path] {
+			return fmt.Errorf("'%s' is listed in the manifest but missing from the archive", entry.Path)
+		}
+	}
+
+	// Directory modes and times go last, deepest first, so that writing
+	// their contents does not undo them.
+	sort.Slice(manifest.Entries, func(i, j int) bool {
+		return manifest.Entries[i].Path > manifest.Entries[j].Path
+	})
+	for _, entry := range manifest.Entries {
+		if entry.Type != "dir" {
+			continue
+		}
+		dest := filepath.Join(dir, filepath.FromSlash(entry.Path))
+		os.Chmod(dest, entry.Mode.Perm())
+		os.Chtimes(dest, entry.ModTime, entry.ModTime)
+	}
+	return nil
+}
+
+func extractSnapshotFile(f snapshotFile, entry ManifestEntry, dest string) error {
+	r, err := f.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	err = os.MkdirAll(filepath.Dir(dest), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, entry.Mode.Perm())
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), r)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != entry.SHA256 {
+		return fmt.Errorf("'%s' does not match its manifest hash", entry.Path)
+	}
+	return os.Chtimes(dest, entry.ModTime, entry.ModTime)
+}
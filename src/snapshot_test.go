@@ -0,0 +1,108 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	for _, format := range []SnapshotFormat{SnapshotTarGz, SnapshotZip} {
+		t.Run(string(format), func(t *testing.T) {
+			projectPath := filepath.Join(t.TempDir(), "proj")
+			writeTree(t, projectPath, map[string]string{
+				"notes.txt":     "notes",
+				"a/b/model.inp": "/PREP7\n",
+			})
+			if err := os.Mkdir(filepath.Join(projectPath, "empty"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink("notes.txt", filepath.Join(projectPath, "link")); err != nil {
+				t.Skipf("symlinks not supported: %v", err)
+			}
+
+			snapshot := &Snapshot{FolderPath: projectPath, Dir: t.TempDir(), Format: format}
+			archivePath, err := snapshot.Create()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Remove(filepath.Join(projectPath, "notes.txt")); err != nil {
+				t.Fatal(err)
+			}
+
+			restored, previous, err := RestoreSnapshot(archivePath, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restored != projectPath || previous == "" {
+				t.Errorf("restored to '%s' with the project moved to '%s'", restored, previous)
+			}
+			assertTree(t, projectPath, []string{"notes.txt", "a/b/model.inp", "link"})
+			if target, err := os.Readlink(filepath.Join(projectPath, "link")); err != nil || target != "notes.txt" {
+				t.Errorf("link points to '%s', %v", target, err)
+			}
+			if info, err := os.Stat(filepath.Join(projectPath, "empty")); err != nil || !info.IsDir() {
+				t.Errorf("empty directory not restored: %v", err)
+			}
+			assertTree(t, previous, []string{"a/b/model.inp", "link"})
+		})
+	}
+}
+
+func TestRestoreSnapshotRefusesEntriesInsideSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	archivePath := filepath.Join(t.TempDir(), "proj.tar.gz")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(file)
+	w := &tarSnapshotWriter{gz: gz, tw: tar.NewWriter(gz)}
+
+	// A symlink out of the project, then a file written through it
+	content := "escaped"
+	sum := sha256.Sum256([]byte(content))
+	manifest := &SnapshotManifest{Root: filepath.Join(t.TempDir(), "proj"), Created: time.Now(), Entries: []ManifestEntry{
+		{Path: "link", Type: "symlink", Mode: os.ModeSymlink | 0777, Target: outside},
+		{Path: "link/evil.txt", Type: "file", Size: int64(len(content)), Mode: 0644, SHA256: hex.EncodeToString(sum[:])},
+	}}
+	for _, entry := range manifest.Entries {
+		var r io.Reader
+		if entry.Type == "file" {
+			r = strings.NewReader(content)
+		}
+		if err := w.add(entry, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.add(ManifestEntry{Path: manifestEntryName, Type: "file", Size: int64(len(data)), Mode: 0644}, strings.NewReader(string(data)))
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = RestoreSnapshot(archivePath, "")
+	if err == nil {
+		t.Error("restored an entry inside a symlink")
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "evil.txt")); !os.IsNotExist(err) {
+		t.Errorf("restore wrote outside the project: %v", err)
+	}
+}
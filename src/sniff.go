@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// sniffLength is how much of a file is read to detect its content type. It
+// is enough to find the directory names near the start of an Office file.
+const sniffLength = 8 << 10
+
+// The content types detected from the first bytes of a file.
+const (
+	ContentPDF      = "pdf"
+	ContentPNG      = "png"
+	ContentJPEG     = "jpeg"
+	ContentZIP      = "zip"
+	ContentDOCX     = "docx"
+	ContentXLSX     = "xlsx"
+	ContentPPTX     = "pptx"
+	ContentELF      = "elf"
+	ContentPE       = "pe"
+	ContentScript   = "script"
+	ContentNotebook = "notebook"
+)
+
+// contentExtensions lists the extensions expected for each content type. An
+// empty extension means files of that type commonly have none.
+var contentExtensions = map[string][]string{
+	ContentPDF:      {".pdf"},
+	ContentPNG:      {".png"},
+	ContentJPEG:     {".jpg", ".jpeg"},
+	ContentZIP:      {".zip", ".jar", ".apk", ".whl", ".epub", ".odt", ".ods", ".odp"},
+	ContentDOCX:     {".docx", ".docm", ".dotx"},
+	ContentXLSX:     {".xlsx", ".xlsm", ".xltx"},
+	ContentPPTX:     {".pptx", ".pptm", ".potx"},
+	ContentELF:      {"", ".so", ".o", ".bin", ".elf", ".out"},
+	ContentPE:       {".exe", ".dll", ".sys", ".scr", ".efi"},
+	ContentScript:   {"", ".sh", ".bash", ".zsh", ".py", ".pl", ".rb", ".php", ".js", ".awk", ".tcl"},
+	ContentNotebook: {".ipynb"},
+}
+
+// isContentType reports whether name is a content type that can be detected.
+func isContentType(name string) bool {
+	_, ok := contentExtensions[name]
+	return ok
+}
+
+// DetectContent returns the content type of a file starting with data, or
+// an empty string if it is not recognized.
+func DetectContent(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return ContentPDF
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return ContentPNG
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return ContentJPEG
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return detectZIP(data)
+	case bytes.HasPrefix(data, []byte("\x7fELF")):
+		return ContentELF
+	case isPE(data):
+		return ContentPE
+	case bytes.HasPrefix(data, []byte("#!")):
+		return ContentScript
+	}
+
+	trimmed := bytes.TrimLeft(data, " \t\r\n\xef\xbb\xbf")
+	if bytes.HasPrefix(trimmed, []byte("{")) && bytes.Contains(data, []byte(`"cells"`)) &&
+		(bytes.Contains(data, []byte(`"nbformat"`)) || bytes.Contains(data, []byte(`"metadata"`))) {
+		return ContentNotebook
+	}
+	return ""
+}
+
+// isPE reports whether data starts with a DOS header pointing at a PE header.
+func isPE(data []byte) bool {
+	if !bytes.HasPrefix(data, []byte("MZ")) || len(data) < 0x40 {
+		return false
+	}
+	offset := int64(binary.LittleEndian.Uint32(data[0x3c:]))
+	return offset+4 <= int64(len(data)) && bytes.Equal(data[offset:offset+4], []byte("PE\x00\x00"))
+}
+
+// detectZIP tells Office documents from other ZIP archives by the names of
+// the entries near the start of the archive.
+func detectZIP(data []byte) string {
+	switch {
+	case bytes.Contains(data, []byte("word/")):
+		return ContentDOCX
+	case bytes.Contains(data, []byte("xl/")):
+		return ContentXLSX
+	case bytes.Contains(data, []byte("ppt/")):
+		return ContentPPTX
+	}
+	return ContentZIP
+}
+
+// SniffContent reads the start of r and returns its content type.
+func SniffContent(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, sniffLength))
+	if err != nil {
+		return "", err
+	}
+	return DetectContent(data), nil
+}
+
+// ContentMismatch reports whether the extension of name is not one expected
+// for the content type. Unrecognized content never mismatches.
+func ContentMismatch(name, content string) bool {
+	expected, ok := contentExtensions[content]
+	if !ok {
+		return false
+	}
+	extension := strings.ToLower(filepath.Ext(name))
+	for _, e := range expected {
+		if e == extension {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestDetectContent(t *testing.T) {
+	pe := make([]byte, 0x80)
+	copy(pe, "MZ")
+	binary.LittleEndian.PutUint32(pe[0x3c:], 0x40)
+	copy(pe[0x40:], "PE\x00\x00")
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"pdf", "%PDF-1.7\n", ContentPDF},
+		{"png", "\x89PNG\r\n\x1a\n....", ContentPNG},
+		{"jpeg", "\xff\xd8\xff\xe0", ContentJPEG},
+		{"zip", "PK\x03\x04....data.txt", ContentZIP},
+		{"docx", "PK\x03\x04....word/document.xml", ContentDOCX},
+		{"xlsx", "PK\x03\x04....xl/workbook.xml", ContentXLSX},
+		{"pptx", "PK\x03\x04....ppt/presentation.xml", ContentPPTX},
+		{"elf", "\x7fELF\x02\x01", ContentELF},
+		{"pe", string(pe), ContentPE},
+		{"dos without pe header", "MZ just text", ""},
+		{"script", "#!/bin/sh\necho hi\n", ContentScript},
+		{"notebook", "\xef\xbb\xbf\n {\"cells\": [], \"metadata\": {}}", ContentNotebook},
+		{"json", `{"name": "cells"}`, ""},
+		{"text", "hello", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		if got := DetectContent([]byte(tt.data)); got != tt.want {
+			t.Errorf("%s: DetectContent = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContentMismatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    bool
+	}{
+		{"report.pdf", ContentPDF, false},
+		{"report.PDF", ContentPDF, false},
+		{"report.docx", ContentPDF, true},
+		{"photo.jpeg", ContentJPEG, false},
+		{"build", ContentELF, false},
+		{"tool.txt", ContentPE, true},
+		{"notes.txt", "", false},
+	}
+	for _, tt := range tests {
+		if got := ContentMismatch(tt.name, tt.content); got != tt.want {
+			t.Errorf("ContentMismatch(%q, %q) = %v, want %v", tt.name, tt.content, got, tt.want)
+		}
+	}
+}
@@ -2,64 +2,111 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
 // FileSorter represents the template for sorting files.
 type FileSorter struct {
 	FolderPath string
+	FileSystem FileSystem
+	Scope      *Scope
+	Layout     *Layout
+	Rules      RuleSet
+	Bundles    BundleSet
+	Conflicts  *ConflictResolver
+	Log        *slog.Logger
+	done       OperationSequence
 }
 
 // Execute executes the template for sorting files.
 func (s *FileSorter) Execute() error {
-	err := filepath.Walk(s.FolderPath, func(path string, info os.FileInfo, err error) error {
+	s.done = nil
+	plans, err := s.plan()
+	if err != nil {
+		return fmt.Errorf("failed to sort files: %w", err)
+	}
+
+	var jobs []*JobIndex
+	jobFolders := make(map[*JobIndex]string)
+	for _, plan := range plans {
+		if !plan.Sorted() {
+			continue
+		}
+		path := plan.Path
+		destFolderPath := filepath.Join(s.FolderPath, plan.Folder)
+		created := missingDirectories(s.FileSystem, destFolderPath)
+		err = s.FileSystem.MkdirAll(destFolderPath, 0755)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to sort files: %w", err)
 		}
+		s.done = append(s.done, &CreateDirectoryOperation{fsys: s.FileSystem, dirPath: destFolderPath, created: created})
 
-		if info.IsDir() {
-			return nil
+		destFilePath := filepath.Join(destFolderPath, filepath.Base(path))
+		movedPath, err := s.Conflicts.Move(s.FileSystem, path, destFilePath)
+		if err != nil {
+			return fmt.Errorf("failed to sort files: failed to move '%s' to '%s': %w", path, destFilePath, err)
 		}
-
-		extension := strings.ToLower(filepath.Ext(path))
-		destFolder := ""
-
-		switch extension {
-		case ".pdf", ".djvu", ".epub", ".html", ".docx", ".md", ".tex", ".txt", ".doc", ".pptx", ".ipynb":
-			destFolder = filepath.Join("doc", strings.TrimSuffix(filepath.Base(path), extension))
-		case ".rst", ".rth", ".cdb", ".ls-dyna", ".db", ".dbb", ".esav", ".out":
-			destFolder = "job"
-		case ".mkv", ".mp4", ".aac", ".flac", ".wav", ".avi", ".png", ".jpeg", ".mov", ".wmv", ".jpg", ".mp3":
-			destFolder = filepath.Join("media", strings.TrimSuffix(filepath.Base(path), extension))
-		case ".py", ".go", ".ans", ".inp", ".c", ".m", ".for", ".cpp", ".java", ".scala", ".php", ".sh", ".asm", ".h", ".dat":
-			destFolder = filepath.Join("src", strings.TrimSuffix(filepath.Base(path), extension))
-		case ".exe":
-			destFolder = "bin"
-		default:
-			destFolder = "data"
+		if movedPath != "" && plan.Job != nil {
+			if _, ok := jobFolders[plan.Job]; !ok {
+				jobs = append(jobs, plan.Job)
+				jobFolders[plan.Job] = destFolderPath
+			}
+			plan.Job.Add(filepath.Base(movedPath), plan.File.Size)
+		}
+		if movedPath == "" || movedPath == path {
+			continue
 		}
+		s.done = append(s.done, &MoveFileOperation{fsys: s.FileSystem, sourcePath: path, destPath: destFilePath, movedPath: movedPath})
 
-		destFolderPath := filepath.Join(s.FolderPath, destFolder)
-		err = os.MkdirAll(destFolderPath, 0755)
+		s.Log.Info("sorted file", "source", path, "destination", movedPath)
+	}
+
+	// List the input deck and outputs of every job next to them
+	for _, job := range jobs {
+		indexPath := filepath.Join(jobFolders[job], jobIndexName)
+		writeOp := &WriteFileOperation{fsys: s.FileSystem, filePath: indexPath, content: job.Bytes()}
+		err = writeOp.Execute()
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to sort files: %w", err)
+		}
+		if writeOp.written {
+			s.done = append(s.done, writeOp)
+			s.Log.Info("wrote job index", "job", job.Jobname, "path", indexPath)
 		}
+	}
+	return nil
+}
 
-		destFilePath := filepath.Join(destFolderPath, filepath.Base(path))
-		err = os.Rename(path, destFilePath)
-		if err != nil {
-			return err
+// plan classifies every file in the project, groups them and bundles them,
+// before any of them is moved.
+func (s *FileSorter) plan() ([]*SortPlan, error) {
+	var plans []*SortPlan
+	err := walkBundled(s.FileSystem, s.FolderPath, s.Scope, func(path, rel string, info os.FileInfo, anchor bool) error {
+		if s.Layout.IsRequiredFile(rel) || isJobIndex(s.FileSystem, path) {
+			return nil
 		}
 
-		fmt.Printf("Moved '%s' to '%s'\n", path, destFilePath)
+		file := NewCandidate(s.FileSystem, path, rel, info)
+		rule, folder := s.Rules.Classify(file)
+		plans = append(plans, &SortPlan{Path: path, File: file, Rule: rule, Folder: folder, Anchor: anchor})
 		return nil
 	})
-
 	if err != nil {
-		return fmt.Errorf("failed to sort files: %w", err)
+		return nil, err
 	}
 
-	return nil
+	s.Layout.GroupPlans(plans)
+	s.Bundles.Apply(plans, s.Rules)
+	return plans, nil
+}
+
+// Inverse returns the operations that move every sorted file back.
+func (s *FileSorter) Inverse() FileOperation {
+	return s.done.Inverse()
+}
+
+func (s *FileSorter) String() string {
+	return fmt.Sprintf("sort files in '%s'", s.FolderPath)
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Summary collects what happened during a run so it can be reported at the end.
+type Summary struct {
+	Moved           int
+	Errors          []error
+	Conflicts       []Conflict
+	Duplicates      []DuplicateGroup
+	DuplicateReport string
+	Links           []LinkDecision
+}
+
+// AddConflict records a conflict.
+func (s *Summary) AddConflict(c Conflict) {
+	s.Conflicts = append(s.Conflicts, c)
+}
+
+// AddLinkDecision records what was done with a symlink or special file.
+func (s *Summary) AddLinkDecision(d LinkDecision) {
+	s.Links = append(s.Links, d)
+}
+
+// Print writes the summary to w.
+func (s *Summary) Print(w io.Writer) {
+	if s.DuplicateReport != "" {
+		var wasted int64
+		for _, group := range s.Duplicates {
+			wasted += group.Wasted()
+		}
+		fmt.Fprintf(w, "Duplicates: %d groups, %s wasted, see '%s'.\n", len(s.Duplicates), formatBytes(wasted), s.DuplicateReport)
+	}
+
+	if len(s.Links) > 0 {
+		fmt.Fprintf(w, "Symlinks and special files (%d):\n", len(s.Links))
+		for _, d := range s.Links {
+			fmt.Fprintf(w, "  %s\n", d)
+		}
+	}
+
+	if len(s.Conflicts) == 0 {
+		fmt.Fprintln(w, "No conflicts.")
+		return
+	}
+
+	fmt.Fprintf(w, "Conflicts (%d):\n", len(s.Conflicts))
+	for _, c := range s.Conflicts {
+		fmt.Fprintf(w, "  %s\n", c)
+	}
+}
+
+// SummaryObject is the JSON form of a Summary that ends JSON output.
+type SummaryObject struct {
+	Type            string         `json:"type"`
+	Project         string         `json:"project"`
+	Status          string         `json:"status"`
+	Error           string         `json:"error,omitempty"`
+	FilesMoved      int            `json:"files_moved"`
+	Conflicts       []Conflict     `json:"conflicts"`
+	DuplicateGroups int            `json:"duplicate_groups"`
+	DuplicateReport string         `json:"duplicate_report,omitempty"`
+	Links           []LinkDecision `json:"links"`
+	Errors          []string       `json:"errors"`
+}
+
+// Object returns the JSON form of the summary of a run on project that ended
+// with err.
+func (s *Summary) Object(project string, err error) SummaryObject {
+	obj := SummaryObject{
+		Type:            "summary",
+		Project:         project,
+		Status:          "ok",
+		FilesMoved:      s.Moved,
+		Conflicts:       s.Conflicts,
+		DuplicateGroups: len(s.Duplicates),
+		DuplicateReport: s.DuplicateReport,
+		Links:           s.Links,
+		Errors:          []string{},
+	}
+	if obj.Conflicts == nil {
+		obj.Conflicts = []Conflict{}
+	}
+	if obj.Links == nil {
+		obj.Links = []LinkDecision{}
+	}
+	for _, e := range s.Errors {
+		obj.Errors = append(obj.Errors, e.Error())
+	}
+	if err != nil {
+		obj.Status = "failed"
+		obj.Error = err.Error()
+	}
+	return obj
+}
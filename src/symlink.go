@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// SymlinkPolicy decides what happens to symlinks inside a project.
+type SymlinkPolicy string
+
+const (
+	// SymlinkKeep leaves links where they are, updating their targets if the
+	// files they point to are moved.
+	SymlinkKeep SymlinkPolicy = "keep"
+	// SymlinkMove moves links like regular files and rewrites their targets
+	// so they still point to the same file.
+	SymlinkMove SymlinkPolicy = "move"
+	// SymlinkResolve replaces links to files with copies of those files.
+	SymlinkResolve SymlinkPolicy = "resolve"
+	// SymlinkSkip leaves links completely untouched.
+	SymlinkSkip SymlinkPolicy = "skip"
+)
+
+// ParseSymlinkPolicy parses the name of a symlink policy.
+func ParseSymlinkPolicy(name string) (SymlinkPolicy, error) {
+	switch policy := SymlinkPolicy(name); policy {
+	case SymlinkKeep, SymlinkMove, SymlinkResolve, SymlinkSkip:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown symlink policy '%s' (want keep, move, resolve or skip)", name)
+}
+
+// LinkDecision records what was decided for a symlink or special file.
+type LinkDecision struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func (d LinkDecision) String() string {
+	if d.Reason == "" {
+		return fmt.Sprintf("'%s': %s", d.Path, d.Action)
+	}
+	return fmt.Sprintf("'%s': %s (%s)", d.Path, d.Action, d.Reason)
+}
+
+// trackedLink is a symlink whose target may need rewriting after the run.
+type trackedLink struct {
+	path     string
+	target   string
+	resolved string
+}
+
+// SymlinkHandler applies the symlink policy to a project and reports what it
+// does with every symlink and special file.
+type SymlinkHandler struct {
+	FolderPath string
+	FileSystem *TrackingFileSystem
+	Scope      *Scope
+	Summary    *Summary
+	links      []trackedLink
+}
+
+// Prepare finds symlinks and special files before the project is changed,
+// replacing links with copies under the resolve policy.
+func (h *SymlinkHandler) Prepare() error {
+	h.links = nil
+	err := h.FileSystem.Walk(h.FolderPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == h.FolderPath {
+			return err
+		}
+		if info.IsDir() && info.Name() == enforceDirName {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(h.FolderPath, path)
+		if err != nil {
+			return err
+		}
+		if h.Scope.Ignore != nil && h.Scope.Ignore.match(filepath.ToSlash(rel), info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if isSpecialFile(info.Mode()) {
+			h.Summary.AddLinkDecision(LinkDecision{Path: path, Action: "skipped", Reason: "special file"})
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return h.prepareLink(path)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check symlinks: %w", err)
+	}
+	return nil
+}
+
+func (h *SymlinkHandler) prepareLink(path string) error {
+	target, err := h.FileSystem.Readlink(path)
+	if err != nil {
+		return err
+	}
+	resolved := target
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(filepath.Dir(path), target)
+	}
+
+	reason := "points to '" + target + "'"
+	if rel, err := filepath.Rel(h.FolderPath, resolved); err != nil || isParentRelative(rel) {
+		reason += ", outside the project"
+	}
+
+	switch h.Scope.Symlinks {
+	case SymlinkSkip:
+		h.Summary.AddLinkDecision(LinkDecision{Path: path, Action: "skipped", Reason: reason})
+		return nil
+
+	case SymlinkResolve:
+		info, err := h.FileSystem.Stat(resolved)
+		if err != nil {
+			h.Summary.AddLinkDecision(LinkDecision{Path: path, Action: "kept", Reason: reason + ", which does not exist"})
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			h.Summary.AddLinkDecision(LinkDecision{Path: path, Action: "kept", Reason: reason + ", which is not a regular file"})
+			return nil
+		}
+		err = h.resolveLink(path, resolved, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		h.Summary.AddLinkDecision(LinkDecision{Path: path, Action: "replaced with a copy", Reason: reason})
+		return nil
+
+	case SymlinkMove:
+		h.Summary.AddLinkDecision(LinkDecision{Path: path, Action: "moved with its target rewritten", Reason: reason})
+	default:
+		h.Summary.AddLinkDecision(LinkDecision{Path: path, Action: "kept in place", Reason: reason})
+	}
+	h.links = append(h.links, trackedLink{path: path, target: target, resolved: resolved})
+	return nil
+}
+
+// resolveLink replaces the link at path with a copy of the file it points to.
+func (h *SymlinkHandler) resolveLink(path, resolved string, perm os.FileMode) error {
+	f, err := h.FileSystem.Open(resolved)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read '%s': %w", resolved, err)
+	}
+
+	err = h.FileSystem.Remove(path)
+	if err != nil {
+		return fmt.Errorf("failed to remove symlink '%s': %w", path, err)
+	}
+	err = h.FileSystem.WriteFile(path, data, perm)
+	if err != nil {
+		return fmt.Errorf("failed to copy '%s' to '%s': %w", resolved, path, err)
+	}
+	return nil
+}
+
+// Finish rewrites the targets of kept and moved links so they still point to
+// the same files after the run.
+func (h *SymlinkHandler) Finish() error {
+	for _, link := range h.links {
+		path := h.FileSystem.Current(link.path)
+		resolved := h.FileSystem.Current(link.resolved)
+
+		target := resolved
+		if !filepath.IsAbs(link.target) {
+			rel, err := filepath.Rel(filepath.Dir(path), resolved)
+			if err != nil {
+				return err
+			}
+			target = rel
+		}
+		if target == link.target {
+			continue
+		}
+
+		err := h.FileSystem.Remove(path)
+		if err == nil {
+			err = h.FileSystem.Symlink(target, path)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to rewrite symlink '%s': %w", path, err)
+		}
+		h.Summary.AddLinkDecision(LinkDecision{Path: path, Action: "retargeted", Reason: "now points to '" + target + "'"})
+	}
+	return nil
+}
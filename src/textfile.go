@@ -3,4 +3,5 @@ package main
 // TextFileFactory is a factory that creates various types of text files.
 type TextFileFactory struct {
 	ProjectPath string
+	FileSystem  FileSystem
 }
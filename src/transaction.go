@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Transaction executes file operations so that a failure reverses every
+// operation that already took effect.
+type Transaction struct {
+	completed []FileOperation
+}
+
+// Execute executes op. If it fails, op and every operation completed before
+// it are reversed in order and a TransactionError is returned.
+func (t *Transaction) Execute(op FileOperation) error {
+	err := op.Execute()
+	if err != nil {
+		return t.Abort(op, err)
+	}
+	t.Record(op)
+	return nil
+}
+
+// Record adds op, which was executed outside the transaction, to the
+// completed operations so that a later failure reverses it too.
+func (t *Transaction) Record(op FileOperation) {
+	t.completed = append(t.completed, op)
+}
+
+// Abort reverses op, which failed with err, and every operation completed
+// before it, and returns a TransactionError.
+func (t *Transaction) Abort(op FileOperation, err error) error {
+	t.completed = append(t.completed, op)
+	rolledBack, rollbackErrs := t.Rollback()
+	return &TransactionError{Failed: op, Err: err, RolledBack: rolledBack, RollbackErrs: rollbackErrs}
+}
+
+// Rollback reverses the completed operations, most recent first, and returns
+// how many were reversed along with any errors encountered.
+func (t *Transaction) Rollback() (int, []error) {
+	var rolledBack int
+	var errs []error
+	for i := len(t.completed) - 1; i >= 0; i-- {
+		inverse := t.completed[i].Inverse()
+		if inverse == nil {
+			continue
+		}
+		err := inverse.Execute()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to reverse %s: %w", t.completed[i], err))
+			continue
+		}
+		rolledBack++
+	}
+	t.completed = nil
+	return rolledBack, errs
+}
+
+// TransactionError reports which operation failed and how the rollback went.
+type TransactionError struct {
+	Failed       FileOperation
+	Err          error
+	RolledBack   int
+	RollbackErrs []error
+}
+
+func (e *TransactionError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "operation %s failed: %v\n", e.Failed, e.Err)
+	fmt.Fprintf(&b, "rolled back %d operations", e.RolledBack)
+	if len(e.RollbackErrs) == 0 {
+		return b.String()
+	}
+	fmt.Fprintf(&b, ", %d could not be rolled back:", len(e.RollbackErrs))
+	for _, err := range e.RollbackErrs {
+		fmt.Fprintf(&b, "\n  %v", err)
+	}
+	return b.String()
+}
+
+func (e *TransactionError) Unwrap() error {
+	return e.Err
+}
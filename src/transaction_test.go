@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransactionRollback(t *testing.T) {
+	tests := []struct {
+		name       string
+		moves      [][2]string
+		err        error
+		rolledBack int
+		want       []string
+	}{
+		{
+			name:  "every operation succeeds",
+			moves: [][2]string{{"a", "x"}, {"b", "y"}},
+			want:  []string{"c", "x", "y"},
+		},
+		{
+			name:       "a failing operation reverses the earlier ones",
+			moves:      [][2]string{{"a", "x"}, {"b", "y"}, {"missing", "z"}},
+			err:        os.ErrNotExist,
+			rolledBack: 2,
+			want:       []string{"a", "b", "c"},
+		},
+		{
+			name:       "a conflict reverses the earlier ones",
+			moves:      [][2]string{{"a", "x"}, {"b", "c"}},
+			err:        ErrConflict,
+			rolledBack: 1,
+			want:       []string{"a", "b", "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{"a": "a", "b": "b", "c": "c"})
+
+			fsys := &OSFileSystem{}
+			tx := &Transaction{}
+			var err error
+			for _, move := range tt.moves {
+				err = tx.Execute(&MoveFileOperation{fsys: fsys, sourcePath: filepath.Join(dir, move[0]), destPath: filepath.Join(dir, move[1])})
+				if err != nil {
+					break
+				}
+			}
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			var txErr *TransactionError
+			if errors.As(err, &txErr) && (txErr.RolledBack != tt.rolledBack || len(txErr.RollbackErrs) > 0) {
+				t.Errorf("rolled back %d operations with errors %v, want %d", txErr.RolledBack, txErr.RollbackErrs, tt.rolledBack)
+			}
+			assertTree(t, dir, tt.want)
+		})
+	}
+}
+
+func TestRunRollsBackOnConflict(t *testing.T) {
+	projectPath := t.TempDir()
+	tree := map[string]string{
+		"a/notes.txt":  "a",
+		"b/notes.txt":  "b",
+		"c/Report.pdf": "%PDF-1.4",
+	}
+	writeTree(t, projectPath, tree)
+
+	run := testRun(projectPath)
+	run.Options.Conflict = ConflictAbort
+	err := run.Execute()
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("error %v, want a conflict", err)
+	}
+	assertTree(t, projectPath, []string{"a/notes.txt", "b/notes.txt", "c/Report.pdf"})
+}
+
+// failingFileSystem fails to rename anything to a path named failName.
+type failingFileSystem struct {
+	FileSystem
+	failName string
+}
+
+func (f *failingFileSystem) Rename(oldPath, newPath string) error {
+	if filepath.Base(newPath) == f.failName {
+		return os.ErrPermission
+	}
+	return f.FileSystem.Rename(oldPath, newPath)
+}
+
+func TestRunRollsBackOnFailedOperation(t *testing.T) {
+	tests := []struct {
+		name     string
+		stages   []string
+		failName string
+	}{
+		{"flatten", []string{StageFlatten}, "b.txt"},
+		{"rename", []string{StageRename}, "some_file.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projectPath := t.TempDir()
+			original := []string{"x/a.txt", "y/b.txt", "Some File.txt"}
+			writeTree(t, projectPath, map[string]string{"x/a.txt": "a", "y/b.txt": "b", "Some File.txt": "c"})
+
+			run := testRun(projectPath, tt.stages...)
+			run.FileSystem = &failingFileSystem{FileSystem: &OSFileSystem{}, failName: tt.failName}
+			err := run.Execute()
+			if !errors.Is(err, os.ErrPermission) {
+				t.Fatalf("error %v, want the failed operation", err)
+			}
+			assertTree(t, projectPath, original)
+		})
+	}
+}
+
+// assertTree fails the test unless the files in dir are exactly want, as
+// slash separated paths relative to dir, leaving out the .enforce directory.
+func assertTree(t *testing.T, dir string, want []string) {
+	t.Helper()
+	got := make(map[string]bool)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == enforceDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		got[filepath.ToSlash(rel)] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range want {
+		if !got[rel] {
+			t.Errorf("missing %s", rel)
+		}
+		delete(got, rel)
+	}
+	for rel := range got {
+		t.Errorf("unexpected %s", rel)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// FindProjects returns the candidate project directories directly inside
+// parent. Hidden directories, symlinks and the version control and
+// dependency directories that are never enforced are left out.
+func FindProjects(parent string) ([]string, error) {
+	entries, err := os.ReadDir(parent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read workspace '%s': %w", parent, err)
+	}
+
+	ignore := NewIgnoreMatcher()
+	var projects []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || strings.HasPrefix(name, ".") || ignore.Match(name, true) {
+			continue
+		}
+		projects = append(projects, filepath.Join(parent, name))
+	}
+	sort.Strings(projects)
+	return projects, nil
+}
+
+// WorkspaceResult records the outcome of enforcing one project of a workspace.
+type WorkspaceResult struct {
+	Project   string
+	Moved     int
+	Conflicts int
+	Errors    int
+	Err       error
+}
+
+// Apply runs apply for the project and records its outcome. A panic is
+// recorded as an error so it does not stop the other projects.
+func (r *WorkspaceResult) Apply(apply func() (*Summary, error)) {
+	defer func() {
+		if p := recover(); p != nil {
+			r.Err = fmt.Errorf("enforce crashed: %v", p)
+		}
+	}()
+
+	summary, err := apply()
+	if summary != nil {
+		r.Moved = summary.Moved
+		r.Conflicts = len(summary.Conflicts)
+		r.Errors = len(summary.Errors)
+	}
+	r.Err = err
+}
+
+// PrintWorkspaceSummary writes a table of the results to w, followed by the
+// error of every project that failed.
+func PrintWorkspaceSummary(w io.Writer, results []*WorkspaceResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Project\tFiles moved\tConflicts\tErrors\t")
+	for _, result := range results {
+		failures := result.Errors
+		if result.Err != nil {
+			failures++
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t\n", filepath.Base(result.Project), result.Moved, result.Conflicts, failures)
+	}
+	tw.Flush()
+
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(w, "%s: %v\n", filepath.Base(result.Project), result.Err)
+		}
+	}
+}
+
+// workspaceProject is the JSON form of a WorkspaceResult.
+type workspaceProject struct {
+	Project    string `json:"project"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	FilesMoved int    `json:"files_moved"`
+	Conflicts  int    `json:"conflicts"`
+	Errors     int    `json:"errors"`
+}
+
+// WorkspaceObject returns the JSON form of the results of a workspace run.
+func WorkspaceObject(parent string, results []*WorkspaceResult) interface{} {
+	projects := []workspaceProject{}
+	for _, result := range results {
+		project := workspaceProject{
+			Project:    result.Project,
+			Status:     "ok",
+			FilesMoved: result.Moved,
+			Conflicts:  result.Conflicts,
+			Errors:     result.Errors,
+		}
+		if result.Err != nil {
+			project.Status = "failed"
+			project.Error = result.Err.Error()
+			project.Errors++
+		}
+		projects = append(projects, project)
+	}
+	return struct {
+		Type      string             `json:"type"`
+		Workspace string             `json:"workspace"`
+		Projects  []workspaceProject `json:"projects"`
+	}{"workspace", parent, projects}
+}